@@ -9,13 +9,17 @@
 package mysql
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/pem"
 	"sync"
+
+	"filippo.io/edwards25519"
 )
 
 // server pub keys registry
@@ -81,6 +85,77 @@ func getServerPubKey(name string) (pubKey *rsa.PublicKey) {
 	return
 }
 
+// AuthPlugin implements an authentication method of the server (a client
+// side authentication plugin).
+//
+// The driver calls InitAuth with the auth data (the scramble) sent by the
+// server in the handshake or in an auth switch request, and sends the
+// returned response to the server. Afterwards, every AuthMoreData packet of
+// the server is passed to ContinueAuth until the server accepts or rejects
+// the authentication.
+type AuthPlugin interface {
+	// InitAuth returns the initial auth response.
+	InitAuth(authData []byte, cfg *Config) ([]byte, error)
+
+	// ContinueAuth handles the data of an AuthMoreData packet. authData is
+	// the scramble passed to InitAuth. The returned response is sent to the
+	// server, unless it is nil.
+	ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error)
+}
+
+// auth plugins registry
+var (
+	authPluginLock     sync.RWMutex
+	authPluginRegistry = map[string]AuthPlugin{
+		"caching_sha2_password": cachingSHA2PasswordPlugin{},
+		"client_ed25519":        ed25519Plugin{},
+		"mysql_clear_password":  clearPasswordPlugin{},
+		"mysql_native_password": nativePasswordPlugin{},
+		"mysql_old_password":    oldPasswordPlugin{},
+		"sha256_password":       sha256PasswordPlugin{},
+	}
+)
+
+// RegisterAuthPlugin registers an auth plugin with the name of the
+// server side plugin. The driver uses it whenever the server requests this
+// plugin. The built-in plugins can be replaced as well.
+//
+// The initial auth response is limited to 255 bytes when resetSession
+// authenticates again with COM_CHANGE_USER, i.e. on servers without
+// COM_RESET_CONNECTION. Longer responses, e.g. tokens, fail the reset there.
+//
+//	type tokenPlugin struct{}
+//
+//	func (tokenPlugin) InitAuth(authData []byte, cfg *mysql.Config) ([]byte, error) {
+//		token, err := fetchToken()
+//		return append([]byte(token), 0), err
+//	}
+//
+//	func (tokenPlugin) ContinueAuth(moreData, authData []byte, cfg *mysql.Config) ([]byte, error) {
+//		return nil, mysql.ErrMalformPkt
+//	}
+//
+//	mysql.RegisterAuthPlugin("authentication_token", tokenPlugin{})
+func RegisterAuthPlugin(name string, plugin AuthPlugin) {
+	authPluginLock.Lock()
+	authPluginRegistry[name] = plugin
+	authPluginLock.Unlock()
+}
+
+// DeregisterAuthPlugin removes the auth plugin registered with the given name.
+func DeregisterAuthPlugin(name string) {
+	authPluginLock.Lock()
+	delete(authPluginRegistry, name)
+	authPluginLock.Unlock()
+}
+
+func getAuthPlugin(name string) AuthPlugin {
+	authPluginLock.RLock()
+	plugin := authPluginRegistry[name]
+	authPluginLock.RUnlock()
+	return plugin
+}
+
 // Hash password using pre 4.1 (old password) method
 // https://github.com/atcurtis/mariadb/blob/master/mysys/my_rnd.c
 type myRnd struct {
@@ -229,194 +304,363 @@ func encryptPassword(password string, seed []byte, pub *rsa.PublicKey) ([]byte,
 	return rsa.EncryptOAEP(sha1, rand.Reader, pub, plain, nil)
 }
 
-func (mc *mysqlConn) sendEncryptedPassword(seed []byte, pub *rsa.PublicKey) error {
-	enc, err := encryptPassword(mc.cfg.Passwd, seed, pub)
-	if err != nil {
-		return err
+// mysql_native_password
+// https://dev.mysql.com/doc/internals/en/secure-password-authentication.html
+type nativePasswordPlugin struct{}
+
+func (nativePasswordPlugin) InitAuth(authData []byte, cfg *Config) ([]byte, error) {
+	if !cfg.AllowNativePasswords {
+		return nil, ErrNativePassword
 	}
-	return mc.writeAuthSwitchPacket(enc)
+	// Native password authentication only need and will need 20-byte challenge.
+	return scramblePassword(authData[:20], cfg.Passwd), nil
 }
 
-func (mc *mysqlConn) auth(authData []byte, plugin string) ([]byte, error) {
-	switch plugin {
-	case "caching_sha2_password":
-		authResp := scrambleSHA256Password(authData, mc.cfg.Passwd)
-		return authResp, nil
-
-	case "mysql_old_password":
-		if !mc.cfg.AllowOldPasswords {
-			return nil, ErrOldPassword
-		}
-		// Note: there are edge cases where this should work but doesn't;
-		// this is currently "wontfix":
-		// https://github.com/go-sql-driver/mysql/issues/184
-		authResp := append(scrambleOldPassword(authData[:8], mc.cfg.Passwd), 0)
-		return authResp, nil
-
-	case "mysql_clear_password":
-		if !mc.cfg.AllowCleartextPasswords {
-			return nil, ErrCleartextPassword
-		}
-		// http://dev.mysql.com/doc/refman/5.7/en/cleartext-authentication-plugin.html
-		// http://dev.mysql.com/doc/refman/5.7/en/pam-authentication-plugin.html
-		return append([]byte(mc.cfg.Passwd), 0), nil
+func (nativePasswordPlugin) ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error) {
+	return nil, ErrMalformPkt
+}
 
-	case "mysql_native_password":
-		if !mc.cfg.AllowNativePasswords {
-			return nil, ErrNativePassword
-		}
-		// https://dev.mysql.com/doc/internals/en/secure-password-authentication.html
-		// Native password authentication only need and will need 20-byte challenge.
-		authResp := scramblePassword(authData[:20], mc.cfg.Passwd)
-		return authResp, nil
-
-	case "sha256_password":
-		if len(mc.cfg.Passwd) == 0 {
-			return []byte{0}, nil
-		}
-		if mc.cfg.tls != nil || mc.cfg.Net == "unix" {
+// mysql_old_password
+type oldPasswordPlugin struct{}
+
+func (oldPasswordPlugin) InitAuth(authData []byte, cfg *Config) ([]byte, error) {
+	if !cfg.AllowOldPasswords {
+		return nil, ErrOldPassword
+	}
+	// Note: there are edge cases where this should work but doesn't;
+	// this is currently "wontfix":
+	// https://github.com/go-sql-driver/mysql/issues/184
+	return append(scrambleOldPassword(authData[:8], cfg.Passwd), 0), nil
+}
+
+func (oldPasswordPlugin) ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error) {
+	return nil, ErrMalformPkt
+}
+
+// mysql_clear_password
+// http://dev.mysql.com/doc/refman/5.7/en/cleartext-authentication-plugin.html
+// http://dev.mysql.com/doc/refman/5.7/en/pam-authentication-plugin.html
+type clearPasswordPlugin struct{}
+
+func (clearPasswordPlugin) InitAuth(authData []byte, cfg *Config) ([]byte, error) {
+	if !cfg.AllowCleartextPasswords {
+		return nil, ErrCleartextPassword
+	}
+	return append([]byte(cfg.Passwd), 0), nil
+}
+
+func (clearPasswordPlugin) ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error) {
+	return nil, ErrMalformPkt
+}
+
+// caching_sha2_password
+// https://insidemysql.com/preparing-your-community-connector-for-mysql-8-part-2-sha256/
+type cachingSHA2PasswordPlugin struct{}
+
+func (cachingSHA2PasswordPlugin) InitAuth(authData []byte, cfg *Config) ([]byte, error) {
+	return scrambleSHA256Password(authData, cfg.Passwd), nil
+}
+
+func (cachingSHA2PasswordPlugin) ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error) {
+	if len(moreData) == 0 {
+		return nil, ErrMalformPkt
+	}
+	if len(moreData) > 1 {
+		// the public key requested below
+		return encryptPasswordPEM(cfg.Passwd, authData, moreData)
+	}
+
+	switch moreData[0] {
+	case cachingSha2PasswordFastAuthSuccess:
+		// the OK packet follows
+		return nil, nil
+
+	case cachingSha2PasswordPerformFullAuthentication:
+		if cfg.secureTransport() {
 			// write cleartext auth packet
-			return append([]byte(mc.cfg.Passwd), 0), nil
+			return append([]byte(cfg.Passwd), 0), nil
 		}
-
-		pubKey := mc.cfg.pubKey
-		if pubKey == nil {
+		if cfg.pubKey == nil {
 			// request public key from server
-			return []byte{1}, nil
+			return []byte{cachingSha2PasswordRequestPublicKey}, nil
 		}
+		// send encrypted password
+		return encryptPassword(cfg.Passwd, authData, cfg.pubKey)
+	}
+	return nil, ErrMalformPkt
+}
 
-		// encrypted password
-		enc, err := encryptPassword(mc.cfg.Passwd, authData, pubKey)
-		return enc, err
+// sha256_password
+type sha256PasswordPlugin struct{}
 
-	default:
+func (sha256PasswordPlugin) InitAuth(authData []byte, cfg *Config) ([]byte, error) {
+	if len(cfg.Passwd) == 0 {
+		return []byte{0}, nil
+	}
+	if cfg.secureTransport() {
+		// write cleartext auth packet
+		return append([]byte(cfg.Passwd), 0), nil
+	}
+
+	pubKey := cfg.pubKey
+	if pubKey == nil {
+		// request public key from server
+		return []byte{1}, nil
+	}
+
+	// encrypted password
+	return encryptPassword(cfg.Passwd, authData, pubKey)
+}
+
+func (sha256PasswordPlugin) ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error) {
+	// the server sent the public key requested by InitAuth
+	return encryptPasswordPEM(cfg.Passwd, authData, moreData)
+}
+
+// client_ed25519 (MariaDB)
+// https://mariadb.com/kb/en/authentication-plugin-ed25519/
+type ed25519Plugin struct{}
+
+func (ed25519Plugin) InitAuth(authData []byte, cfg *Config) ([]byte, error) {
+	return signEd25519(authData, cfg.Passwd)
+}
+
+func (ed25519Plugin) ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error) {
+	return nil, ErrMalformPkt
+}
+
+// signEd25519 signs the scramble with Ed25519. Unlike RFC 8032, MariaDB uses
+// the SHA-512 hash of the password of any length to derive the key, see
+// plugin/auth_ed25519/ref10/sign.c in the MariaDB server.
+func signEd25519(scramble []byte, password string) ([]byte, error) {
+	h := sha512.Sum512([]byte(password))
+
+	// secret scalar s and public key A = sB
+	s, err := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	if err != nil {
+		return nil, err
+	}
+	A := new(edwards25519.Point).ScalarBaseMult(s)
+
+	// r = SHA-512(prefix || scramble), R = rB
+	digest := sha512.New()
+	digest.Write(h[32:])
+	digest.Write(scramble)
+	r, err := edwards25519.NewScalar().SetUniformBytes(digest.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	R := new(edwards25519.Point).ScalarBaseMult(r)
+
+	// k = SHA-512(R || A || scramble), S = ks + r
+	digest.Reset()
+	digest.Write(R.Bytes())
+	digest.Write(A.Bytes())
+	digest.Write(scramble)
+	k, err := edwards25519.NewScalar().SetUniformBytes(digest.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	S := edwards25519.NewScalar().MultiplyAdd(k, s, r)
+
+	// signature R || S
+	return append(R.Bytes(), S.Bytes()...), nil
+}
+
+// encryptPasswordPEM encrypts the password with the PEM encoded public key
+// sent by the server
+func encryptPasswordPEM(password string, seed, data []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrMalformPkt
+	}
+	pkix, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := pkix.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrMalformPkt
+	}
+	return encryptPassword(password, seed, pub)
+}
+
+// secureTransport reports whether passwords may be sent in cleartext
+func (cfg *Config) secureTransport() bool {
+	return cfg.tls != nil || cfg.Net == "unix"
+}
+
+func (mc *mysqlConn) auth(authData []byte, plugin string) ([]byte, error) {
+	return initAuth(authData, plugin, mc.cfg)
+}
+
+func initAuth(authData []byte, plugin string, cfg *Config) ([]byte, error) {
+	p := getAuthPlugin(plugin)
+	if p == nil {
 		errLog.Print("unknown auth plugin:", plugin)
 		return nil, ErrUnknownPlugin
 	}
+	return p.InitAuth(authData, cfg)
 }
 
-func (mc *mysqlConn) handleAuthResult(oldAuthData []byte, plugin string) error {
-	// Read Result Packet
-	authData, newPlugin, err := mc.readAuthResult()
+// factorConfig returns the config to authenticate the given factor of
+// multi-factor authentication, with the password of that factor
+func (mc *mysqlConn) factorConfig(factor int) *Config {
+	cfg := mc.cfg.Clone()
+	switch factor {
+	case 2:
+		cfg.Passwd = mc.cfg.Passwd2
+	case 3:
+		cfg.Passwd = mc.cfg.Passwd3
+	}
+	return cfg
+}
+
+// changeUser authenticates again with COM_CHANGE_USER, using the scramble of
+// the handshake. This resets the session state like COM_RESET_CONNECTION.
+func (mc *mysqlConn) changeUser() error {
+	authResp, err := mc.auth(mc.authData, mc.authPlugin)
 	if err != nil {
 		return err
 	}
+	if err = mc.writeChangeUserPacket(authResp, mc.authPlugin); err != nil {
+		return err
+	}
+	return mc.handleAuthResult(mc.authData, mc.authPlugin)
+}
 
-	// handle auth plugin switch, if requested
-	if newPlugin != "" {
-		// If CLIENT_PLUGIN_AUTH capability is not supported, no new cipher is
-		// sent and we have to keep using the cipher sent in the init packet.
-		if authData == nil {
-			authData = oldAuthData
-		} else {
-			// copy data from read buffer to owned slice
-			copy(oldAuthData, authData)
-		}
-
-		plugin = newPlugin
+// mustChangePassword reports whether err is ER_MUST_CHANGE_PASSWORD, which
+// the server returns for statements in sandbox mode.
+func mustChangePassword(err error) bool {
+	me, ok := err.(*MySQLError)
+	return ok && me.Number == 1820
+}
 
-		authResp, err := mc.auth(authData, plugin)
-		if err != nil {
-			return err
-		}
-		if err = mc.writeAuthSwitchPacket(authResp); err != nil {
+// handleExpiredPassword sets the password returned by
+// Config.ChangeExpiredPassword after the server put the session into sandbox
+// mode, because the password of the account has expired. Connections of the
+// connector wait for a change in progress. If it set another password than
+// the one of mc, mc authenticates again with it instead of changing it again.
+func (c *connector) handleExpiredPassword(ctx context.Context, mc *mysqlConn) error {
+	c.passwdLock.Lock()
+	defer c.passwdLock.Unlock()
+
+	if c.passwd != "" && c.passwd != mc.cfg.Passwd {
+		cfg := mc.cfg
+		mc.cfg = cfg.Clone()
+		mc.cfg.Passwd = c.passwd
+		if err := mc.changeUser(); err != nil {
+			mc.cfg = cfg
 			return err
 		}
+		return nil
+	}
+
+	passwd, err := mc.cfg.ChangeExpiredPassword(ctx, mc.cfg.Clone())
+	if err != nil {
+		return err
+	}
 
+	query := []byte("ALTER USER CURRENT_USER() IDENTIFIED BY '")
+	if mc.status&statusNoBackslashEscapes == 0 {
+		query = escapeStringBackslash(query, passwd)
+	} else {
+		query = escapeStringQuotes(query, passwd)
+	}
+	query = append(query, '\'')
+	if err = mc.exec(string(query)); err != nil {
+		return err
+	}
+
+	// COM_CHANGE_USER must use the new password
+	mc.cfg = mc.cfg.Clone()
+	mc.cfg.Passwd = passwd
+	c.passwd = passwd
+	return nil
+}
+
+func (mc *mysqlConn) handleAuthResult(oldAuthData []byte, plugin string) error {
+	cfg := mc.cfg
+	factor := 1
+	switched := false // the plugin may only be switched once per factor
+
+	for {
 		// Read Result Packet
-		authData, newPlugin, err = mc.readAuthResult()
+		authData, newPlugin, nextFactor, err := mc.readAuthResult()
 		if err != nil {
 			return err
 		}
 
-		// Do not allow to change the auth plugin more than once
-		if newPlugin != "" {
-			return ErrMalformPkt
-		}
-	}
-
-	switch plugin {
+		switch {
+		// multi-factor authentication: the previous factor was accepted and
+		// the server requests the next one with the given plugin
+		case nextFactor:
+			factor++
+			if factor > 3 {
+				return ErrMalformPkt
+			}
+			cfg = mc.factorConfig(factor)
+			plugin = newPlugin
+			switched = false
 
-	// https://insidemysql.com/preparing-your-community-connector-for-mysql-8-part-2-sha256/
-	case "caching_sha2_password":
-		switch len(authData) {
-		case 0:
-			return nil // auth successful
-		case 1:
-			switch authData[0] {
-			case cachingSha2PasswordFastAuthSuccess:
-				if err = mc.readResultOK(); err == nil {
-					return nil // auth successful
-				}
+			// copy data from read buffer to owned slice
+			oldAuthData = append([]byte(nil), authData...)
 
-			case cachingSha2PasswordPerformFullAuthentication:
-				if mc.cfg.tls != nil || mc.cfg.Net == "unix" {
-					// write cleartext auth packet
-					err = mc.writeAuthSwitchPacket(append([]byte(mc.cfg.Passwd), 0))
-					if err != nil {
-						return err
-					}
-				} else {
-					pubKey := mc.cfg.pubKey
-					if pubKey == nil {
-						// request public key from server
-						data, err := mc.buf.takeSmallBuffer(4 + 1)
-						if err != nil {
-							return err
-						}
-						data[4] = cachingSha2PasswordRequestPublicKey
-						mc.writePacket(data)
-
-						// parse public key
-						if data, err = mc.readPacket(); err != nil {
-							return err
-						}
-
-						block, _ := pem.Decode(data[1:])
-						pkix, err := x509.ParsePKIXPublicKey(block.Bytes)
-						if err != nil {
-							return err
-						}
-						pubKey = pkix.(*rsa.PublicKey)
-					}
-
-					// send encrypted password
-					err = mc.sendEncryptedPassword(oldAuthData, pubKey)
-					if err != nil {
-						return err
-					}
-				}
-				return mc.readResultOK()
+			authResp, err := initAuth(oldAuthData, plugin, cfg)
+			if err != nil {
+				return err
+			}
+			if err = mc.writeAuthSwitchPacket(authResp); err != nil {
+				return err
+			}
 
-			default:
+		// handle auth plugin switch, if requested
+		case newPlugin != "":
+			// Do not allow to change the auth plugin more than once
+			if switched {
 				return ErrMalformPkt
 			}
-		default:
-			return ErrMalformPkt
-		}
+			switched = true
+
+			// If CLIENT_PLUGIN_AUTH capability is not supported, no new cipher is
+			// sent and we have to keep using the cipher sent in the init packet.
+			if authData == nil {
+				authData = oldAuthData
+			} else {
+				// copy data from read buffer to owned slice
+				copy(oldAuthData, authData)
+			}
 
-	case "sha256_password":
-		switch len(authData) {
-		case 0:
-			return nil // auth successful
-		default:
-			block, _ := pem.Decode(authData)
-			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			plugin = newPlugin
+
+			authResp, err := initAuth(authData, plugin, cfg)
 			if err != nil {
 				return err
 			}
+			if err = mc.writeAuthSwitchPacket(authResp); err != nil {
+				return err
+			}
+
+		// auth successful
+		case authData == nil:
+			return nil
 
-			// send encrypted password
-			err = mc.sendEncryptedPassword(oldAuthData, pub.(*rsa.PublicKey))
+		// The plugin handles further auth data until the server sends OK
+		default:
+			switched = true
+			p := getAuthPlugin(plugin)
+			if p == nil {
+				return ErrUnknownPlugin
+			}
+			resp, err := p.ContinueAuth(authData, oldAuthData, cfg)
 			if err != nil {
 				return err
 			}
-			return mc.readResultOK()
+			if resp != nil {
+				if err = mc.writeAuthSwitchPacket(resp); err != nil {
+					return err
+				}
+			}
 		}
-
-	default:
-		return nil // auth successful
 	}
-
-	return err
 }
@@ -10,12 +10,16 @@ package mysql
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"testing"
+
+	"filippo.io/edwards25519"
 )
 
 var testPubKey = []byte("-----BEGIN PUBLIC KEY-----\n" +
@@ -1328,3 +1332,181 @@ func TestAuthSwitchSHA256PasswordSecure(t *testing.T) {
 		t.Errorf("got unexpected data: %v", conn.written)
 	}
 }
+
+type testAuthPlugin struct{}
+
+func (testAuthPlugin) InitAuth(authData []byte, cfg *Config) ([]byte, error) {
+	return append([]byte(cfg.Passwd), 0), nil
+}
+
+func (testAuthPlugin) ContinueAuth(moreData, authData []byte, cfg *Config) ([]byte, error) {
+	if string(moreData) != "challenge" {
+		return nil, ErrMalformPkt
+	}
+	return []byte("answer"), nil
+}
+
+func TestAuthSwitchRegisteredPlugin(t *testing.T) {
+	RegisterAuthPlugin("test_plugin", testAuthPlugin{})
+	defer DeregisterAuthPlugin("test_plugin")
+
+	conn, mc := newRWMockConn(2)
+	mc.cfg.Passwd = "token"
+
+	// auth switch request
+	conn.data = appendTestPacket(nil, 2, append([]byte{iEOF}, "test_plugin\x00scramble\x00"...))
+
+	// more data, then OK
+	conn.queuedReplies = [][]byte{
+		appendTestPacket(nil, 4, append([]byte{iAuthMoreData}, "challenge"...)),
+		appendTestPacket(nil, 6, []byte{iOK, 0, 0, 2, 0, 0, 0}),
+	}
+
+	authData := []byte{123, 87, 15, 84, 20, 58, 37, 121, 91, 117, 51, 24, 19,
+		47, 43, 9, 41, 112, 67, 110}
+	if err := mc.handleAuthResult(authData, "mysql_native_password"); err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	var expected []byte
+	expected = appendTestPacket(expected, 3, []byte("token\x00"))
+	expected = appendTestPacket(expected, 5, []byte("answer"))
+	if !bytes.Equal(conn.written, expected) {
+		t.Errorf("got unexpected data: %v", conn.written)
+	}
+
+	// unregistered plugins are rejected
+	DeregisterAuthPlugin("test_plugin")
+	conn, mc = newRWMockConn(2)
+	conn.data = appendTestPacket(nil, 2, append([]byte{iEOF}, "test_plugin\x00scramble\x00"...))
+	if err := mc.handleAuthResult(authData, "mysql_native_password"); err != ErrUnknownPlugin {
+		t.Errorf("expected ErrUnknownPlugin, got %v", err)
+	}
+}
+
+func TestHandshakeResponseLongPluginName(t *testing.T) {
+	const plugin = "authentication_ldap_sasl_client"
+	authResp := []byte("token\x00")
+
+	for _, flags := range []clientFlag{0, clientConnectAttrs} {
+		conn, mc := newRWMockConn(1)
+		mc.flags = flags
+		if err := mc.writeHandshakeResponsePacket(authResp, plugin); err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+
+		expected := plugin + "\x00"
+		if flags&clientConnectAttrs != 0 {
+			attrs, err := mc.cfg.appendConnectionAttributes(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected += string(attrs)
+		}
+		if !bytes.HasSuffix(conn.written, []byte(expected)) {
+			t.Errorf("plugin name or connection attributes missing: %q", conn.written)
+		}
+	}
+}
+
+func TestAuthSwitchLongResponse(t *testing.T) {
+	conn, mc := newRWMockConn(3)
+	authData := bytes.Repeat([]byte{'x'}, 8192)
+	if err := mc.writeAuthSwitchPacket(authData); err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	if expected := appendTestPacket(nil, 3, authData); !bytes.Equal(conn.written, expected) {
+		t.Errorf("got unexpected data of length %d", len(conn.written))
+	}
+}
+
+func TestSignEd25519(t *testing.T) {
+	scramble := []byte("0123456789abcdef0123456789abcdef")
+	sig, err := signEd25519(scramble, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the public key is derived from SHA-512(password), not from a seed
+	h := sha512.Sum512([]byte("secret"))
+	s, err := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := new(edwards25519.Point).ScalarBaseMult(s).Bytes()
+	if !ed25519.Verify(pub, scramble, sig) {
+		t.Errorf("invalid signature %x", sig)
+	}
+}
+
+func TestAuthSwitchEd25519(t *testing.T) {
+	conn, mc := newRWMockConn(2)
+	mc.cfg.Passwd = "secret"
+
+	// auth switch request with a 32 byte scramble
+	scramble := []byte("0123456789abcdef0123456789abcdef")
+	conn.data = appendTestPacket(nil, 2, append([]byte("\xfeclient_ed25519\x00"), scramble...))
+	conn.queuedReplies = [][]byte{appendTestPacket(nil, 4, []byte{iOK, 0, 0, 2, 0, 0, 0})}
+
+	authData := []byte{123, 87, 15, 84, 20, 58, 37, 121, 91, 117, 51, 24, 19,
+		47, 43, 9, 41, 112, 67, 110}
+	if err := mc.handleAuthResult(authData, "mysql_native_password"); err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	sig, err := signEd25519(scramble, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := appendTestPacket(nil, 3, sig); !bytes.Equal(conn.written, expected) {
+		t.Errorf("got unexpected data: %v", conn.written)
+	}
+}
+
+func TestAuthNextFactor(t *testing.T) {
+	conn, mc := newRWMockConn(2)
+	mc.flags |= clientMultiFactorAuthentication
+	mc.cfg.Passwd = "first"
+	mc.cfg.Passwd2 = "second"
+	mc.cfg.Passwd3 = "third"
+	mc.cfg.AllowCleartextPasswords = true
+
+	// the first factor was accepted, next factors: mysql_native_password and
+	// mysql_clear_password
+	scramble := []byte{96, 71, 63, 8, 1, 58, 75, 12, 69, 95, 66, 60, 117, 31,
+		48, 31, 89, 39, 55, 31}
+	nextFactor2 := append([]byte("\x02mysql_native_password\x00"), scramble...)
+	conn.data = appendTestPacket(nil, 2, append(nextFactor2, 0))
+	conn.queuedReplies = [][]byte{
+		appendTestPacket(nil, 4, []byte("\x02mysql_clear_password\x00")),
+		appendTestPacket(nil, 6, []byte{iOK, 0, 0, 2, 0, 0, 0}),
+	}
+
+	authData := []byte{123, 87, 15, 84, 20, 58, 37, 121, 91, 117, 51, 24, 19,
+		47, 43, 9, 41, 112, 67, 110}
+	if err := mc.handleAuthResult(authData, "mysql_native_password"); err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	var expected []byte
+	expected = appendTestPacket(expected, 3, scramblePassword(scramble, "second"))
+	expected = appendTestPacket(expected, 5, []byte("third\x00"))
+	if !bytes.Equal(conn.written, expected) {
+		t.Errorf("got unexpected data:\n%v\n%v", conn.written, expected)
+	}
+	if mc.cfg.Passwd != "first" {
+		t.Error("the password of the connection was replaced")
+	}
+
+	// at most three factors are supported
+	conn, mc = newRWMockConn(2)
+	mc.cfg.AllowCleartextPasswords = true
+	conn.data = appendTestPacket(nil, 2, []byte("\x02mysql_clear_password\x00"))
+	conn.queuedReplies = [][]byte{
+		appendTestPacket(nil, 4, []byte("\x02mysql_clear_password\x00")),
+		appendTestPacket(nil, 6, []byte("\x02mysql_clear_password\x00")),
+	}
+	if err := mc.handleAuthResult(authData, "mysql_native_password"); err != ErrMalformPkt {
+		t.Errorf("expected ErrMalformPkt, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"database/sql/driver"
+	"io"
+)
+
+// The methods in this file implement the replication protocol on top of the
+// packet layer. They are used by the replication package, which decodes the
+// binlog events, and are not meant to be used on pooled connections.
+// https://dev.mysql.com/doc/internals/en/replication-protocol.html
+
+// RegisterReplica registers the connection as a replica with the given server
+// id using COM_REGISTER_SLAVE. The host, user, password and port are shown
+// by SHOW REPLICAS on the source.
+func (mc *mysqlConn) RegisterReplica(serverID uint32, host, user, password string, port uint16) error {
+	if mc.closed.IsSet() {
+		errLog.Print(ErrInvalidConn)
+		return driver.ErrBadConn
+	}
+	if len(host) > 255 || len(user) > 255 || len(password) > 255 {
+		return ErrMalformPkt
+	}
+
+	// Reset Packet Sequence
+	mc.resetSequence()
+
+	pktLen := 1 + 4 + 1 + len(host) + 1 + len(user) + 1 + len(password) + 2 + 4 + 4
+	data, err := mc.buf.takeSmallBuffer(pktLen + 4)
+	if err != nil {
+		// cannot take the buffer. Something must be wrong with the connection
+		errLog.Print(err)
+		return errBadConnNoWrite
+	}
+
+	// command [1 byte]
+	data[4] = comRegisterSlave
+
+	// server id [4 bytes]
+	data[5] = byte(serverID)
+	data[6] = byte(serverID >> 8)
+	data[7] = byte(serverID >> 16)
+	data[8] = byte(serverID >> 24)
+	pos := 9
+
+	// hostname, user, password [1 byte length + string]
+	for _, s := range []string{host, user, password} {
+		data[pos] = byte(len(s))
+		pos++
+		pos += copy(data[pos:], s)
+	}
+
+	// port [2 bytes]
+	data[pos] = byte(port)
+	data[pos+1] = byte(port >> 8)
+	pos += 2
+
+	// replication rank [4 bytes], source id [4 bytes], both ignored
+	for i := 0; i < 8; i++ {
+		data[pos+i] = 0
+	}
+
+	if err = mc.writePacket(data); err != nil {
+		return mc.markBadConn(err)
+	}
+	return mc.readResultOK()
+}
+
+// DumpBinlog requests the binlog events starting at the given file and
+// position with COM_BINLOG_DUMP. The events are read with ReadBinlogEvent.
+func (mc *mysqlConn) DumpBinlog(serverID uint32, flags uint16, file string, pos uint32) error {
+	if mc.closed.IsSet() {
+		errLog.Print(ErrInvalidConn)
+		return driver.ErrBadConn
+	}
+
+	// Reset Packet Sequence
+	mc.resetSequence()
+
+	pktLen := 1 + 4 + 2 + 4 + len(file)
+	data, err := mc.buf.takeBuffer(pktLen + 4)
+	if err != nil {
+		// cannot take the buffer. Something must be wrong with the connection
+		errLog.Print(err)
+		return errBadConnNoWrite
+	}
+
+	// command [1 byte]
+	data[4] = comBinlogDump
+
+	// binlog position [4 bytes]
+	data[5] = byte(pos)
+	data[6] = byte(pos >> 8)
+	data[7] = byte(pos >> 16)
+	data[8] = byte(pos >> 24)
+
+	// flags [2 bytes]
+	data[9] = byte(flags)
+	data[10] = byte(flags >> 8)
+
+	// server id [4 bytes]
+	data[11] = byte(serverID)
+	data[12] = byte(serverID >> 8)
+	data[13] = byte(serverID >> 16)
+	data[14] = byte(serverID >> 24)
+
+	// binlog filename [string<EOF>]
+	copy(data[15:], file)
+
+	return mc.markBadConn(mc.writePacket(data))
+}
+
+// DumpBinlogGTID requests the binlog events with COM_BINLOG_DUMP_GTID.
+// gtidSet is the encoded set of GTIDs the replica already has, which is sent
+// if flags contains BINLOG_THROUGH_GTID (0x04).
+func (mc *mysqlConn) DumpBinlogGTID(serverID uint32, flags uint16, file string, pos uint64, gtidSet []byte) error {
+	if mc.closed.IsSet() {
+		errLog.Print(ErrInvalidConn)
+		return driver.ErrBadConn
+	}
+
+	// Reset Packet Sequence
+	mc.resetSequence()
+
+	pktLen := 1 + 2 + 4 + 4 + len(file) + 8 + 4 + len(gtidSet)
+	data, err := mc.buf.takeBuffer(pktLen + 4)
+	if err != nil {
+		// cannot take the buffer. Something must be wrong with the connection
+		errLog.Print(err)
+		return errBadConnNoWrite
+	}
+
+	// command [1 byte]
+	data[4] = comBinlogDumpGTID
+
+	// flags [2 bytes]
+	data[5] = byte(flags)
+	data[6] = byte(flags >> 8)
+
+	// server id [4 bytes]
+	data[7] = byte(serverID)
+	data[8] = byte(serverID >> 8)
+	data[9] = byte(serverID >> 16)
+	data[10] = byte(serverID >> 24)
+
+	// binlog filename length [4 bytes] and filename
+	n := uint32(len(file))
+	data[11] = byte(n)
+	data[12] = byte(n >> 8)
+	data[13] = byte(n >> 16)
+	data[14] = byte(n >> 24)
+	p := 15 + copy(data[15:], file)
+
+	// binlog position [8 bytes]
+	for i := 0; i < 8; i++ {
+		data[p+i] = byte(pos >> (8 * uint(i)))
+	}
+	p += 8
+
+	// GTID set length [4 bytes] and data
+	n = uint32(len(gtidSet))
+	data[p] = byte(n)
+	data[p+1] = byte(n >> 8)
+	data[p+2] = byte(n >> 16)
+	data[p+3] = byte(n >> 24)
+	copy(data[p+4:], gtidSet)
+
+	return mc.markBadConn(mc.writePacket(data))
+}
+
+// ReadBinlogEvent returns the next event of the binlog stream requested with
+// DumpBinlog or DumpBinlogGTID, starting with the event header. It returns
+// io.EOF if the server ended the stream.
+// The returned slice is only valid until the next read.
+func (mc *mysqlConn) ReadBinlogEvent() ([]byte, error) {
+	data, err := mc.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case data[0] == iOK:
+		return data[1:], nil
+	case data[0] == iEOF:
+		// events start with 0x00, this is the EOF or OK packet ending the stream
+		return nil, io.EOF
+	default:
+		return nil, mc.handleErrorPacket(data)
+	}
+}
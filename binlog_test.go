@@ -0,0 +1,90 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDumpBinlog(t *testing.T) {
+	event := []byte{1, 2, 3, 4}
+	var reply []byte
+	reply = appendTestPacket(reply, 1, append([]byte{iOK}, event...))
+	reply = appendTestPacket(reply, 2, []byte{iEOF, 0, 0, 2, 0})
+
+	conn, mc := newRWMockConn(0)
+	conn.queuedReplies = [][]byte{reply}
+	if err := mc.DumpBinlog(42, 0x01, "binlog.000001", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		24, 0, 0, 0, comBinlogDump,
+		4, 0, 0, 0, // position
+		0x01, 0, // flags
+		42, 0, 0, 0, // server id
+	}
+	expected = append(expected, "binlog.000001"...)
+	if !bytes.Equal(conn.written, expected) {
+		t.Fatalf("unexpected COM_BINLOG_DUMP packet:\n%v\n%v", conn.written, expected)
+	}
+
+	data, err := mc.ReadBinlogEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, event) {
+		t.Errorf("expected event %v, got %v", event, data)
+	}
+	if _, err = mc.ReadBinlogEvent(); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the stream, got %v", err)
+	}
+}
+
+func TestDumpBinlogGTID(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	gtidSet := []byte{0xaa, 0xbb}
+	if err := mc.DumpBinlogGTID(7, 0x04, "", 4, gtidSet); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		25, 0, 0, 0, comBinlogDumpGTID,
+		0x04, 0, // flags
+		7, 0, 0, 0, // server id
+		0, 0, 0, 0, // filename length
+		4, 0, 0, 0, 0, 0, 0, 0, // position
+		2, 0, 0, 0, 0xaa, 0xbb, // GTID set
+	}
+	if !bytes.Equal(conn.written, expected) {
+		t.Errorf("unexpected COM_BINLOG_DUMP_GTID packet:\n%v\n%v", conn.written, expected)
+	}
+}
+
+func TestRegisterReplica(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	conn.queuedReplies = [][]byte{{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}}
+	if err := mc.RegisterReplica(42, "replica", "", "", 3306); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		25, 0, 0, 0, comRegisterSlave,
+		42, 0, 0, 0, // server id
+		7, 'r', 'e', 'p', 'l', 'i', 'c', 'a', // host
+		0, 0, // user, password
+		0xea, 0x0c, // port
+		0, 0, 0, 0, 0, 0, 0, 0, // rank, source id
+	}
+	if !bytes.Equal(conn.written, expected) {
+		t.Errorf("unexpected COM_REGISTER_SLAVE packet:\n%v\n%v", conn.written, expected)
+	}
+}
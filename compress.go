@@ -0,0 +1,189 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+)
+
+const (
+	// compressed packet header: length [24 bit], sequence [8 bit],
+	// length before compression [24 bit]
+	compressedHeaderSize = 7
+
+	// payloads smaller than this are not worth compressing. This is the
+	// MIN_COMPRESS_LENGTH used by libmysqlclient.
+	defaultCompressionThreshold = 50
+)
+
+// compIO implements the compressed client/server protocol.
+// http://dev.mysql.com/doc/internals/en/compressed-packet-header.html
+//
+// It sits between the regular packet framing and the network: every
+// compressed packet carries one or more regular packets (or parts of them)
+// as its payload.
+type compIO struct {
+	mc   *mysqlConn
+	data []byte // decompressed bytes which were not consumed yet
+
+	zr    io.ReadCloser
+	zw    *zlib.Writer
+	wbuf  bytes.Buffer
+	level int
+}
+
+func newCompIO(mc *mysqlConn) *compIO {
+	level := mc.cfg.CompressionLevel
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+	return &compIO{
+		mc:    mc,
+		level: level,
+	}
+}
+
+// readNext returns the next n decompressed bytes.
+// The returned slice is owned by the caller and stays valid after later reads.
+func (c *compIO) readNext(need int) ([]byte, error) {
+	for len(c.data) < need {
+		if err := c.readCompressedPacket(); err != nil {
+			return nil, err
+		}
+	}
+
+	data := c.data[:need:need]
+	c.data = c.data[need:]
+	return data, nil
+}
+
+func (c *compIO) readCompressedPacket() error {
+	mc := c.mc
+
+	header, err := mc.buf.readNext(compressedHeaderSize)
+	if err != nil {
+		return err
+	}
+
+	comprLen := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	uncomprLen := int(uint32(header[4]) | uint32(header[5])<<8 | uint32(header[6])<<16)
+
+	// Neither libmysqlclient nor the server check the sequence of compressed
+	// packets they receive; the server may answer with an error packet before
+	// it has read everything we sent. Just stay in sync with the server.
+	mc.compressSequence = header[3] + 1
+
+	payload, err := mc.buf.readNext(comprLen)
+	if err != nil {
+		return err
+	}
+
+	// Always copy into a new slice: the read buffer is overwritten by the
+	// next read and slices returned by readNext must remain valid.
+	var data []byte
+	if uncomprLen == 0 {
+		// payload was sent uncompressed
+		data = make([]byte, len(c.data)+comprLen)
+		copy(data[copy(data, c.data):], payload)
+		c.data = data
+		return nil
+	}
+
+	data = make([]byte, len(c.data)+uncomprLen)
+	n := copy(data, c.data)
+
+	if c.zr == nil {
+		c.zr, err = zlib.NewReader(bytes.NewReader(payload))
+	} else {
+		err = c.zr.(zlib.Resetter).Reset(bytes.NewReader(payload), nil)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = io.ReadFull(c.zr, data[n:]); err != nil {
+		return err
+	}
+
+	c.data = data
+	return nil
+}
+
+// writePackets compresses and writes the given regular packets.
+// It returns the number of bytes of packets which were written.
+func (c *compIO) writePackets(packets []byte) (int, error) {
+	mc := c.mc
+	threshold := mc.cfg.CompressionThreshold
+	if threshold <= 0 {
+		threshold = defaultCompressionThreshold
+	}
+
+	total := len(packets)
+	for len(packets) > 0 {
+		payloadLen := len(packets)
+		if payloadLen > maxPacketSize {
+			payloadLen = maxPacketSize
+		}
+		payload := packets[:payloadLen]
+
+		buf := &c.wbuf
+		buf.Reset()
+		buf.Write(make([]byte, compressedHeaderSize))
+
+		uncomprLen := 0
+		if payloadLen >= threshold {
+			if c.zw == nil {
+				zw, err := zlib.NewWriterLevel(buf, c.level)
+				if err != nil {
+					return total - len(packets), err
+				}
+				c.zw = zw
+			} else {
+				c.zw.Reset(buf)
+			}
+
+			_, err := c.zw.Write(payload)
+			if err == nil {
+				err = c.zw.Close()
+			}
+			if err != nil {
+				return total - len(packets), err
+			}
+			if buf.Len()-compressedHeaderSize < payloadLen {
+				uncomprLen = payloadLen
+			}
+		}
+		if uncomprLen == 0 {
+			// compression is disabled for small payloads or did not pay off
+			buf.Truncate(compressedHeaderSize)
+			buf.Write(payload)
+		}
+
+		data := buf.Bytes()
+		comprLen := len(data) - compressedHeaderSize
+		data[0] = byte(comprLen)
+		data[1] = byte(comprLen >> 8)
+		data[2] = byte(comprLen >> 16)
+		data[3] = mc.compressSequence
+		data[4] = byte(uncomprLen)
+		data[5] = byte(uncomprLen >> 8)
+		data[6] = byte(uncomprLen >> 16)
+
+		n, err := mc.netConn.Write(data)
+		if err != nil || n != len(data) {
+			// The compressed byte count is only used to tell the caller
+			// whether anything was written at all.
+			return total - len(packets) + n, err
+		}
+		mc.compressSequence++
+		packets = packets[payloadLen:]
+	}
+	return total, nil
+}
@@ -0,0 +1,87 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newCompressedMockConn() (*mockConn, *mysqlConn) {
+	conn, mc := newRWMockConn(0)
+	mc.flags |= clientCompress
+	mc.compIO = newCompIO(mc)
+	return conn, mc
+}
+
+// compressRoundTrip writes data as a packet over a compressed connection and
+// reads it back from the written bytes.
+func compressRoundTrip(t *testing.T, data []byte) []byte {
+	conn, mc := newCompressedMockConn()
+
+	pkt := make([]byte, 4+len(data))
+	copy(pkt[4:], data)
+	if err := mc.writePacket(pkt); err != nil {
+		t.Fatal(err)
+	}
+
+	rconn, rmc := newCompressedMockConn()
+	rconn.data = conn.written
+	rmc.sequence = 0
+
+	got, err := rmc.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	tests := [][]byte{
+		[]byte("SELECT 1"), // below the threshold, sent uncompressed
+		bytes.Repeat([]byte("SELECT * FROM test WHERE value = 'gopher';"), 100),
+		make([]byte, 1<<16),
+	}
+
+	for i, data := range tests {
+		got := compressRoundTrip(t, data)
+		if !bytes.Equal(got, data) {
+			t.Errorf("%d: data mismatch after round trip: got %d bytes, want %d bytes", i, len(got), len(data))
+		}
+	}
+}
+
+func TestCompressHeader(t *testing.T) {
+	conn, mc := newCompressedMockConn()
+	mc.cfg.CompressionThreshold = 10
+
+	payload := bytes.Repeat([]byte{'a'}, 1000)
+	pkt := make([]byte, 4+len(payload))
+	copy(pkt[4:], payload)
+	if err := mc.writePacket(pkt); err != nil {
+		t.Fatal(err)
+	}
+
+	hdr := conn.written[:compressedHeaderSize]
+	comprLen := int(uint32(hdr[0]) | uint32(hdr[1])<<8 | uint32(hdr[2])<<16)
+	uncomprLen := int(uint32(hdr[4]) | uint32(hdr[5])<<8 | uint32(hdr[6])<<16)
+
+	if comprLen != len(conn.written)-compressedHeaderSize {
+		t.Errorf("wrong compressed length: got %d, want %d", comprLen, len(conn.written)-compressedHeaderSize)
+	}
+	if comprLen >= len(pkt) {
+		t.Errorf("payload was not compressed: %d bytes", comprLen)
+	}
+	if uncomprLen != len(pkt) {
+		t.Errorf("wrong uncompressed length: got %d, want %d", uncomprLen, len(pkt))
+	}
+	if hdr[3] != 0 || mc.compressSequence != 1 {
+		t.Errorf("wrong compressed sequence: %d, next %d", hdr[3], mc.compressSequence)
+	}
+}
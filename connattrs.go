@@ -0,0 +1,78 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const driverName = "Go-MySQL-Driver"
+
+// defaultConnectionAttributes are sent with every connection, unless they are
+// overridden by Config.ConnectionAttributes.
+// https://dev.mysql.com/doc/refman/8.0/en/performance-schema-connection-attribute-tables.html
+var defaultConnectionAttributes = map[string]string{
+	"_client_name":    driverName,
+	"_client_version": driverVersion,
+	"_os":             runtime.GOOS,
+	"_platform":       runtime.GOARCH,
+	"_pid":            strconv.Itoa(os.Getpid()),
+	"program_name":    filepath.Base(os.Args[0]),
+}
+
+// parseConnectionAttributes parses a comma-separated list of key:value pairs
+func parseConnectionAttributes(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	if s == "" {
+		return attrs, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.New("invalid connection attribute: " + pair)
+		}
+		attrs[kv[0]] = kv[1]
+	}
+	return attrs, nil
+}
+
+// appendConnectionAttributes appends the length-encoded connection attributes
+// of the handshake response: the default attributes and those of the config.
+func (cfg *Config) appendConnectionAttributes(b []byte) ([]byte, error) {
+	attrs, err := parseConnectionAttributes(cfg.ConnectionAttributes)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range defaultConnectionAttributes {
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var kv []byte
+	for _, key := range keys {
+		kv = appendLengthEncodedString(kv, key)
+		kv = appendLengthEncodedString(kv, attrs[key])
+	}
+
+	b = appendLengthEncodedInteger(b, uint64(len(kv)))
+	return append(b, kv...), nil
+}
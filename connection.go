@@ -38,13 +38,25 @@ type mysqlConn struct {
 
 	flags            clientFlag
 	status           statusFlag
+	warnings         uint16 // warning count of the last OK / EOF packet
+	info             string // human readable status of the last OK packet
+	session          SessionState // session state changes of the last OK packet
 
 	sequence         uint8	//一个命令拆分多个包时,需要标记 第一个, 新的命令会重置为1
+	compressSequence uint8   // sequence of compressed packets
+	compIO           *compIO // set when the compressed protocol is in use
 	parseTime        bool
 	reset            bool // set when the Go SQL package calls ResetSession
+	noResetConn      bool // set if the server does not support COM_RESET_CONNECTION
+	authData         []byte // scramble of the handshake, used by COM_CHANGE_USER
+	authPlugin       string // auth plugin of the handshake
+	queryAttrs       map[string]string // query attributes for the next command
+	connectionID     uint32 // thread id of the connection, used by KILL QUERY
+	serverVersion    string // version of the handshake
 
 	// for context support (Go 1.8+)
 	watching bool
+	watchCtx context.Context // the context of the last watched statement
 	watcher  chan<- context.Context
 	closech  chan struct{}
 	finished chan<- struct{}
@@ -194,13 +206,13 @@ func (mc *mysqlConn) Prepare(query string) (driver.Stmt, error) {
 	columnCount, err := stmt.readPrepareResultPacket()
 	if err == nil {
 		if stmt.paramCount > 0 {
-			if err = mc.readUntilEOF(); err != nil {
+			if err = mc.skipColumns(stmt.paramCount); err != nil {
 				return nil, err
 			}
 		}
 
 		if columnCount > 0 {
-			err = mc.readUntilEOF()
+			err = mc.skipColumns(int(columnCount))
 		}
 	}
 
@@ -361,19 +373,23 @@ func (mc *mysqlConn) Exec(query string, args []driver.Value) (driver.Result, err
 	mc.insertId = 0
 
 	err := mc.exec(query)
-	if err == nil {
-		return &mysqlResult{
-			affectedRows: int64(mc.affectedRows),
-			insertId:     int64(mc.insertId),
-		}, err
+	if err != nil {
+		return nil, mc.markBadConn(err)
 	}
-	return nil, mc.markBadConn(err)
+
+	res := &mysqlResult{
+		affectedRows: int64(mc.affectedRows),
+		insertId:     int64(mc.insertId),
+		warningCount: mc.warnings,
+	}
+	res.warnings, err = mc.fetchWarnings()
+	return res, err
 }
 
 // Internal function to execute commands
 func (mc *mysqlConn) exec(query string) error {
 	// Send command
-	if err := mc.writeCommandPacketStr(comQuery, query); err != nil {
+	if err := mc.writeQueryPacket(query); err != nil {
 		return mc.markBadConn(err)
 	}
 
@@ -385,7 +401,7 @@ func (mc *mysqlConn) exec(query string) error {
 
 	if resLen > 0 {
 		// columns
-		if err := mc.readUntilEOF(); err != nil {
+		if err := mc.skipColumns(resLen); err != nil {
 			return err
 		}
 
@@ -419,7 +435,7 @@ func (mc *mysqlConn) query(query string, args []driver.Value) (*textRows, error)
 		query = prepared
 	}
 	// Send command
-	err := mc.writeCommandPacketStr(comQuery, query)
+	err := mc.writeQueryPacket(query)
 	if err == nil {
 		// Read Result
 		var resLen int
@@ -453,7 +469,7 @@ func (mc *mysqlConn) query(query string, args []driver.Value) (*textRows, error)
 // 读取数据库系统变量的值
 func (mc *mysqlConn) getSystemVar(name string) ([]byte, error) {
 	// Send command
-	if err := mc.writeCommandPacketStr(comQuery, "SELECT @@"+name); err != nil {
+	if err := mc.writeQueryPacket("SELECT @@" + name); err != nil {
 		return nil, err
 	}
 
@@ -466,7 +482,7 @@ func (mc *mysqlConn) getSystemVar(name string) ([]byte, error) {
 
 		if resLen > 0 {
 			// Columns
-			if err := mc.readUntilEOF(); err != nil {
+			if err := mc.skipColumns(resLen); err != nil {
 				return nil, err
 			}
 		}
@@ -544,6 +560,11 @@ func (mc *mysqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver
 }
 
 func (mc *mysqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	// Cursors require a prepared statement, let database/sql prepare one
+	if fetchSizeFromContext(ctx) > 0 {
+		return nil, driver.ErrSkip
+	}
+
 	dargs, err := namedValueToValue(args)
 	if err != nil {
 		return nil, err
@@ -552,6 +573,8 @@ func (mc *mysqlConn) QueryContext(ctx context.Context, query string, args []driv
 	if err := mc.watchCancel(ctx); err != nil {
 		return nil, err
 	}
+	mc.queryAttrs = queryAttributesFromContext(ctx)
+	defer mc.clearQueryAttributes()
 
 	rows, err := mc.query(query, dargs)
 	if err != nil {
@@ -572,6 +595,8 @@ func (mc *mysqlConn) ExecContext(ctx context.Context, query string, args []drive
 		return nil, err
 	}
 	defer mc.finish()
+	mc.queryAttrs = queryAttributesFromContext(ctx)
+	defer mc.clearQueryAttributes()
 
 	return mc.Exec(query, dargs)
 }
@@ -605,13 +630,26 @@ func (stmt *mysqlStmt) QueryContext(ctx context.Context, args []driver.NamedValu
 	if err := stmt.mc.watchCancel(ctx); err != nil {
 		return nil, err
 	}
+	stmt.mc.queryAttrs = queryAttributesFromContext(ctx)
+	defer stmt.mc.clearQueryAttributes()
 
-	rows, err := stmt.query(dargs)
+	var rows *binaryRows
+	if fetchSize := fetchSizeFromContext(ctx); fetchSize > 0 {
+		rows, err = stmt.openCursor(dargs, fetchSize)
+	} else {
+		rows, err = stmt.query(dargs)
+	}
 	if err != nil {
 		stmt.mc.finish()
 		return nil, err
 	}
-	rows.finish = stmt.mc.finish
+	if rows.stmt != nil {
+		// each batch fetched from the cursor is watched on its own
+		stmt.mc.finish()
+		rows.ctx = ctx
+	} else {
+		rows.finish = stmt.mc.finish
+	}
 	return rows, err
 }
 
@@ -625,6 +663,8 @@ func (stmt *mysqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue
 		return nil, err
 	}
 	defer stmt.mc.finish()
+	stmt.mc.queryAttrs = queryAttributesFromContext(ctx)
+	defer stmt.mc.clearQueryAttributes()
 
 	return stmt.Exec(dargs)
 }
@@ -636,6 +676,9 @@ func (mc *mysqlConn) watchCancel(ctx context.Context) error {
 		mc.cleanup()
 		return nil
 	}
+	// The context of the last statement is kept after finish, since the
+	// rest of its result set can still be interrupted by KILL QUERY.
+	mc.watchCtx = nil
 	// When ctx is already cancelled, don't watch it.
 	if err := ctx.Err(); err != nil {
 		return err
@@ -650,6 +693,7 @@ func (mc *mysqlConn) watchCancel(ctx context.Context) error {
 	}
 
 	mc.watching = true
+	mc.watchCtx = ctx
 	mc.watcher <- ctx
 	return nil
 }
@@ -670,7 +714,33 @@ func (mc *mysqlConn) startWatcher() {
 
 			select {
 			case <-ctx.Done():
-				mc.cancel(ctx.Err())
+				if !mc.cfg.KillQueryOnCancel {
+					mc.cancel(ctx.Err())
+					break
+				}
+				// KILL QUERY needs a new connection, so it is sent in the
+				// background while finish can still be called.
+				killed := make(chan error, 1)
+				go func() {
+					killed <- mc.killQuery()
+				}()
+				select {
+				case err := <-killed:
+					if err != nil {
+						mc.cancel(ctx.Err())
+						break
+					}
+					// The statement fails with ER_QUERY_INTERRUPTED and the
+					// connection stays usable. Wait until it has finished.
+					select {
+					case <-finished:
+					case <-mc.closech:
+						return
+					}
+				case <-finished:
+				case <-mc.closech:
+					return
+				}
 			case <-finished:
 			case <-mc.closech:
 				return
@@ -679,6 +749,32 @@ func (mc *mysqlConn) startWatcher() {
 	}()
 }
 
+// killQuery kills the running statement with KILL QUERY, which is sent on a
+// new connection with the same config.
+func (mc *mysqlConn) killQuery() error {
+	cfg := mc.cfg.Clone()
+	cfg.KillQueryOnCancel = false
+	cfg.BeforeConnect = nil
+	cfg.AfterConnect = nil
+
+	ctx := context.Background()
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	c, err := (&connector{cfg: cfg}).Connect(ctx)
+	if err == nil {
+		defer c.Close()
+		_, err = c.(*mysqlConn).ExecContext(ctx, "KILL QUERY "+strconv.FormatUint(uint64(mc.connectionID), 10), nil)
+	}
+	if err != nil {
+		errLog.Print("could not kill the query: ", err)
+	}
+	return err
+}
+
 func (mc *mysqlConn) CheckNamedValue(nv *driver.NamedValue) (err error) {
 	nv.Value, err = converter{}.ConvertValue(nv.Value)
 	return
@@ -691,5 +787,46 @@ func (mc *mysqlConn) ResetSession(ctx context.Context) error {
 		return driver.ErrBadConn
 	}
 	mc.reset = true
+	if !mc.cfg.ResetSession {
+		return nil
+	}
+
+	if err := mc.watchCancel(ctx); err != nil {
+		return err
+	}
+	defer mc.finish()
+
+	if err := mc.resetConnection(ctx); err != nil {
+		errLog.Print("could not reset the session: ", err)
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// resetConnection resets the session state with COM_RESET_CONNECTION, or by
+// authenticating again with COM_CHANGE_USER if the server does not support
+// it, and applies the DSN params and Config.AfterConnect again.
+func (mc *mysqlConn) resetConnection(ctx context.Context) (err error) {
+	if mc.noResetConn {
+		err = mc.changeUser()
+	} else {
+		if err = mc.writeCommandPacket(comResetConnection); err == nil {
+			err = mc.readResultOK()
+		}
+		// ER_UNKNOWN_COM_ERROR: MySQL < 5.7.3, MariaDB < 10.2.4
+		if me, ok := err.(*MySQLError); ok && me.Number == 1047 {
+			mc.noResetConn = true
+			err = mc.changeUser()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err = mc.handleParams(); err != nil {
+		return err
+	}
+	if mc.cfg.AfterConnect != nil {
+		return mc.cfg.AfterConnect(ctx, initConn{mc})
+	}
 	return nil
 }
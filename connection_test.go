@@ -9,12 +9,16 @@
 package mysql
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"net"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestInterpolateParams(t *testing.T) {
@@ -188,6 +192,150 @@ func TestPingErrInvalidConn(t *testing.T) {
 	}
 }
 
+// showWarningsResult returns the response to SHOW WARNINGS with one warning
+func showWarningsResult(level, code, message string) []byte {
+	row := []byte{byte(len(level))}
+	row = append(row, level...)
+	row = append(row, byte(len(code)))
+	row = append(row, code...)
+	row = append(row, byte(len(message)))
+	row = append(row, message...)
+
+	var data []byte
+	data = appendTestPacket(data, 1, []byte{3})
+	data = appendTestPacket(data, 2, testColumnDefinition("Level", fieldTypeVarString))
+	data = appendTestPacket(data, 3, testColumnDefinition("Code", fieldTypeLong))
+	data = appendTestPacket(data, 4, testColumnDefinition("Message", fieldTypeVarString))
+	data = appendTestPacket(data, 5, []byte{iEOF, 0, 0, 0x02, 0})
+	data = appendTestPacket(data, 6, row)
+	data = appendTestPacket(data, 7, []byte{iEOF, 0, 0, 0x02, 0})
+	return data
+}
+
+func TestExecWarnings(t *testing.T) {
+	// OK packet with 1 affected row and 1 warning
+	okPkt := appendTestPacket(nil, 1, []byte{iOK, 1, 0, 0x02, 0, 1, 0})
+	warnings := showWarningsResult("Warning", "1265", "Data truncated for column 'a' at row 1")
+
+	conn, mc := newRWMockConn(0)
+	conn.queuedReplies = [][]byte{okPkt}
+	res, err := mc.Exec("INSERT INTO test VALUES ('too long')", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := res.(*mysqlResult).WarningCount(); n != 1 {
+		t.Errorf("expected 1 warning, got %d", n)
+	}
+	if w := res.(*mysqlResult).Warnings(); w != nil {
+		t.Errorf("warnings fetched although not configured: %v", w)
+	}
+
+	conn, mc = newRWMockConn(0)
+	mc.cfg.FetchWarnings = true
+	conn.queuedReplies = [][]byte{okPkt, warnings}
+	res, err = mc.Exec("INSERT INTO test VALUES ('too long')", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MySQLWarnings{{Level: "Warning", Code: "1265", Message: "Data truncated for column 'a' at row 1"}}
+	if w := res.(*mysqlResult).Warnings(); !reflect.DeepEqual(w, expected) {
+		t.Errorf("expected %v, got %v", expected, w)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("expected 1 affected row, got %d", n)
+	}
+
+	conn, mc = newRWMockConn(0)
+	mc.cfg.WarningsAsErrors = "error"
+	conn.queuedReplies = [][]byte{okPkt, warnings}
+	if _, err = mc.Exec("INSERT INTO test VALUES ('too long')", nil); err != nil {
+		t.Errorf("expected warning below severity to be ignored, got %v", err)
+	}
+
+	conn, mc = newRWMockConn(0)
+	mc.cfg.WarningsAsErrors = "warning"
+	conn.queuedReplies = [][]byte{okPkt, warnings}
+	_, err = mc.Exec("INSERT INTO test VALUES ('too long')", nil)
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+}
+
+func TestExecWarningsFetchFails(t *testing.T) {
+	// OK packet with 1 affected row and 1 warning
+	okPkt := appendTestPacket(nil, 1, []byte{iOK, 1, 0, 0x02, 0, 1, 0})
+
+	// SHOW WARNINGS cannot be sent
+	conn, mc := newRWMockConn(0)
+	mc.cfg.FetchWarnings = true
+	conn.queuedReplies = [][]byte{okPkt}
+	conn.maxWrites = 1
+	res, err := mc.Exec("INSERT INTO test VALUES ('too long')", nil)
+	if err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %#v", err)
+	}
+	if res == nil {
+		t.Fatal("expected the result of the statement")
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("expected 1 affected row, got %d", n)
+	}
+
+	// SHOW WARNINGS fails
+	errPkt := appendTestPacket(nil, 1, []byte{iERR, 0x7a, 0x04, '#', 'H', 'Y', '0', '0', '0', 'f', 'a', 'i', 'l'})
+	conn, mc = newRWMockConn(0)
+	mc.cfg.FetchWarnings = true
+	conn.queuedReplies = [][]byte{okPkt, errPkt}
+	res, err = mc.Exec("INSERT INTO test VALUES ('too long')", nil)
+	if me, ok := err.(*MySQLError); !ok || me.Number != 1146 {
+		t.Errorf("expected MySQLError 1146, got %#v", err)
+	}
+	if res == nil {
+		t.Fatal("expected the result of the statement")
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("expected 1 affected row, got %d", n)
+	}
+}
+
+func TestWarningsRaw(t *testing.T) {
+	// OK packet with 1 affected row and 1 warning
+	okPkt := appendTestPacket(nil, 1, []byte{iOK, 1, 0, 0x02, 0, 1, 0})
+	warnings := showWarningsResult("Warning", "1265", "Data truncated for column 'a' at row 1")
+	RegisterDialContext("warningsraw", func(ctx context.Context, addr string) (net.Conn, error) {
+		return newHandshakeMockConn(okPkt, warnings), nil
+	})
+
+	cfg := NewConfig()
+	cfg.Net = "warningsraw"
+	cfg.Addr = "127.0.0.1:3306"
+	cfg.FetchWarnings = true
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var w WarningsResult
+	err = conn.Raw(func(driverConn interface{}) error {
+		res, err := driverConn.(driver.ExecerContext).ExecContext(context.Background(), "INSERT INTO test VALUES ('too long')", nil)
+		w, _ = res.(WarningsResult)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w == nil || w.WarningCount() != 1 || len(w.Warnings()) != 1 {
+		t.Errorf("expected 1 warning, got %v", w)
+	}
+}
+
 type badConnection struct {
 	n   int
 	err error
@@ -201,3 +349,187 @@ func (bc badConnection) Write(b []byte) (n int, err error) {
 func (bc badConnection) Close() error {
 	return nil
 }
+
+func TestResetSession(t *testing.T) {
+	okPkt := []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+
+	conn, mc := newRWMockConn(0)
+	mc.cfg.ResetSession = true
+	conn.queuedReplies = [][]byte{okPkt}
+	if err := mc.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(conn.written, []byte{1, 0, 0, 0, comResetConnection}) {
+		t.Errorf("expected COM_RESET_CONNECTION, got %v", conn.written)
+	}
+
+	// fall back to COM_CHANGE_USER if the server does not know the command
+	unknownCom := []byte{0x18, 0, 0, 1, iERR, 0x17, 0x04, '#', '0', '8', 'S', '0', '1',
+		'U', 'n', 'k', 'n', 'o', 'w', 'n', ' ', 'c', 'o', 'm', 'm', 'a', 'n', 'd'}
+	conn, mc = newRWMockConn(0)
+	mc.cfg.ResetSession = true
+	mc.cfg.User = "root"
+	mc.cfg.Passwd = "secret"
+	mc.authData = []byte("01234567890123456789")
+	mc.authPlugin = "mysql_native_password"
+	conn.queuedReplies = [][]byte{unknownCom, okPkt}
+	if err := mc.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !mc.noResetConn {
+		t.Error("COM_RESET_CONNECTION was not marked as unsupported")
+	}
+
+	changeUser := conn.written[5:]
+	if changeUser[4] != comChangeUser {
+		t.Fatalf("expected COM_CHANGE_USER, got %v", changeUser)
+	}
+	authResp := scramblePassword(mc.authData, mc.cfg.Passwd)
+	expected := append([]byte{comChangeUser, 'r', 'o', 'o', 't', 0, byte(len(authResp))}, authResp...)
+	if !bytes.HasPrefix(changeUser[4:], expected) {
+		t.Errorf("unexpected COM_CHANGE_USER packet: %v", changeUser)
+	}
+
+	// the next reset uses COM_CHANGE_USER right away
+	conn.written = nil
+	conn.queuedReplies = [][]byte{okPkt}
+	if err := mc.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if conn.written[4] != comChangeUser {
+		t.Errorf("expected COM_CHANGE_USER, got %v", conn.written)
+	}
+
+	// AfterConnect runs again after the reset
+	conn, mc = newRWMockConn(0)
+	mc.cfg.ResetSession = true
+	mc.cfg.AfterConnect = func(ctx context.Context, conn InitConn) error {
+		_, err := conn.Exec("SET ROLE ?", "app_reader")
+		return err
+	}
+	conn.queuedReplies = [][]byte{okPkt, okPkt}
+	if err := mc.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(conn.written, []byte("SET ROLE 'app_reader'")) {
+		t.Errorf("the statement of AfterConnect was not run: %q", conn.written)
+	}
+}
+
+func TestKillQuery(t *testing.T) {
+	// handshake of a server with connection id 165
+	handshake := []byte{72, 0, 0, 0, 10, 53, 46, 53, 46, 56, 0, 165, 0, 0, 0,
+		60, 70, 63, 58, 68, 104, 34, 97, 0, 223, 247, 33, 2, 0, 15, 128, 21, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 98, 120, 114, 47, 85, 75, 109, 99, 51, 77,
+		50, 64, 0, 109, 121, 115, 113, 108, 95, 110, 97, 116, 105, 118, 101, 95,
+		112, 97, 115, 115, 119, 111, 114, 100}
+	side := &mockConn{
+		data: handshake,
+		queuedReplies: [][]byte{
+			{7, 0, 0, 2, iOK, 0, 0, 2, 0, 0, 0}, // auth
+			{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}, // KILL QUERY
+		},
+	}
+	RegisterDialContext("killquery", func(ctx context.Context, addr string) (net.Conn, error) {
+		return side, nil
+	})
+
+	_, mc := newRWMockConn(0)
+	mc.cfg.Net = "killquery"
+	mc.cfg.KillQueryOnCancel = true
+	mc.cfg.BeforeConnect = func(ctx context.Context, cfg *Config) error {
+		return errors.New("BeforeConnect was run for the side connection")
+	}
+	mc.connectionID = 165
+	if err := mc.killQuery(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(side.written, []byte{comQuery, 'K', 'I', 'L', 'L', ' ', 'Q', 'U', 'E', 'R', 'Y', ' ', '1', '6', '5'}) {
+		t.Errorf("KILL QUERY was not sent: %q", side.written)
+	}
+	if !side.closed {
+		t.Error("the side connection was not closed")
+	}
+
+	// the killed statement returns the error of the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mc.watching = true
+	mc.watchCtx = ctx
+	interrupted := []byte{iERR, 0x25, 0x05, '#', '7', '0', '1', '0', '0',
+		'Q', 'u', 'e', 'r', 'y', ' ', 'e', 'x', 'e', 'c', 'u', 't', 'i', 'o', 'n', ' ',
+		'w', 'a', 's', ' ', 'i', 'n', 't', 'e', 'r', 'r', 'u', 'p', 't', 'e', 'd'}
+	if err := mc.handleErrorPacket(interrupted); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	// e.g. while Close discards the rest of the rows after finish
+	mc.watching = false
+	if err := mc.handleErrorPacket(interrupted); err != context.Canceled {
+		t.Errorf("expected context.Canceled after finish, got %v", err)
+	}
+	mc.cfg.KillQueryOnCancel = false
+	if err, ok := mc.handleErrorPacket(interrupted).(*MySQLError); !ok || err.Number != 1317 {
+		t.Errorf("expected ER_QUERY_INTERRUPTED, got %v", err)
+	}
+}
+
+func TestKillQueryDoesNotBlockFinish(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	RegisterDialContext("killqueryslow", func(ctx context.Context, addr string) (net.Conn, error) {
+		close(dialing)
+		<-release
+		return nil, errors.New("connection refused")
+	})
+
+	_, mc := newRWMockConn(0)
+	mc.cfg.Net = "killqueryslow"
+	mc.cfg.KillQueryOnCancel = true
+	mc.startWatcher()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := mc.watchCancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-dialing
+
+	// the statement finishes while KILL QUERY is still being sent
+	finished := make(chan struct{})
+	go func() {
+		mc.finish()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("finish waited for KILL QUERY")
+	}
+	close(release)
+}
+
+func TestKillQueryFallback(t *testing.T) {
+	RegisterDialContext("killqueryfail", func(ctx context.Context, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	_, mc := newRWMockConn(0)
+	mc.cfg.Net = "killqueryfail"
+	mc.cfg.KillQueryOnCancel = true
+	mc.startWatcher()
+
+	// the connection is closed if KILL QUERY cannot be sent
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := mc.watchCancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-mc.closech:
+	case <-time.After(time.Second):
+		t.Fatal("the connection was not closed")
+	}
+	if err := mc.canceled.Value(); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -12,47 +12,89 @@ import (
 	"context"
 	"database/sql/driver"
 	"net"
+	"sync"
+	"time"
 )
 
 type connector struct {
-	cfg *Config // immutable private copy.
+	cfg   *Config   // immutable private copy.
+	hosts *hostList // state of the hosts of multi-host addresses
+
+	passwdLock sync.Mutex // serializes changes of expired passwords
+	passwd     string     // password set by the last change
 }
 
-// Connect implements 标准库里 driver.Connector interface.
-// Connect returns a connection to the database. 返回一个数据库连接
-func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
-	var err error
+func newConnector(cfg *Config) *connector {
+	c := &connector{cfg: cfg}
+	if addrs := splitAddrs(cfg.Addr); len(addrs) > 1 {
+		c.hosts = newHostList(addrs, cfg.HostPolicy, cfg.HostBackoff)
+	}
+	return c
+}
 
-	// New mysqlConn
-	mc := &mysqlConn{
-		maxAllowedPacket: maxPacketSize,
-		maxWriteSize:     maxPacketSize - 1,
-		closech:          make(chan struct{}),
-		cfg:              c.cfg,
+// dial connects to addr with the dial function registered for the network.
+func dial(ctx context.Context, cfg *Config, addr string) (net.Conn, error) {
+	if cfg.ProxyNet != "" {
+		return dialProxy(ctx, cfg, addr)
 	}
-	mc.parseTime = mc.cfg.ParseTime
 
-	// Connect to Server
 	dialsLock.RLock()
-	dial, ok := dials[mc.cfg.Net]
+	dial, ok := dials[cfg.Net]
 	dialsLock.RUnlock()
 	if ok {
 		dctx := ctx
-		if mc.cfg.Timeout > 0 {
+		if cfg.Timeout > 0 {
 			var cancel context.CancelFunc
-			dctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+			dctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
 			defer cancel()
 		}
 		//使用设置的拨号器
-		mc.netConn, err = dial(dctx, mc.cfg.Addr)
-	} else {
-		nd := net.Dialer{Timeout: mc.cfg.Timeout}
-		//默认拨号器
-		mc.netConn, err = nd.DialContext(ctx, mc.cfg.Net, mc.cfg.Addr)
+		return dial(dctx, addr)
 	}
+	nd := net.Dialer{Timeout: cfg.Timeout}
+	//默认拨号器
+	return nd.DialContext(ctx, cfg.Net, addr)
+}
 
-	if err != nil {
-		return nil, err
+// dialHosts dials the hosts of a multi-host address until one accepts the
+// connection and sends its handshake. Hosts which fail are put into backoff.
+func (c *connector) dialHosts(ctx context.Context, cfg *Config) (mc *mysqlConn, authData []byte, plugin string, err error) {
+	for _, addr := range c.hosts.candidates(time.Now()) {
+		var conn net.Conn
+		if conn, err = dial(ctx, cfg, addr); err == nil {
+			mc, authData, plugin, err = startConn(ctx, cfg.forHost(addr), conn)
+			if err == nil {
+				c.hosts.succeeded(addr)
+				return mc, authData, plugin, nil
+			}
+		}
+		c.hosts.failed(addr, time.Now())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, nil, "", err
+}
+
+// startConn creates the mysqlConn for a dialed connection and reads the
+// handshake of the server. On success the context is watched and the caller
+// must call finish.
+func startConn(ctx context.Context, cfg *Config, conn net.Conn) (*mysqlConn, []byte, string, error) {
+	mc := &mysqlConn{
+		maxAllowedPacket: maxPacketSize,
+		maxWriteSize:     maxPacketSize - 1,
+		closech:          make(chan struct{}),
+		cfg:              cfg,
+		netConn:          conn,
+	}
+	mc.parseTime = mc.cfg.ParseTime
+
+	// The PROXY protocol header precedes the handshake
+	if mc.cfg.ProxyProtocol != "" {
+		if err := mc.writeProxyHeader(); err != nil {
+			mc.netConn.Close()
+			return nil, nil, "", err
+		}
 	}
 
 	// Enable TCP Keepalives on TCP connections
@@ -61,7 +103,7 @@ func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
 			// Don't send COM_QUIT before handshake.
 			mc.netConn.Close()
 			mc.netConn = nil
-			return nil, err
+			return nil, nil, "", err
 		}
 	}
 
@@ -69,9 +111,8 @@ func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
 	mc.startWatcher()
 	if err := mc.watchCancel(ctx); err != nil {
 		mc.cleanup()
-		return nil, err
+		return nil, nil, "", err
 	}
-	defer mc.finish()
 
 	mc.buf = newBuffer(mc.netConn)
 
@@ -83,8 +124,46 @@ func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
 	authData, plugin, err := mc.readHandshakePacket()
 	if err != nil {
 		mc.cleanup()
+		return nil, nil, "", err
+	}
+	return mc, authData, plugin, nil
+}
+
+// Connect implements 标准库里 driver.Connector interface.
+// Connect returns a connection to the database. 返回一个数据库连接
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var err error
+
+	// Obtain the credentials etc. for this connection
+	cfg := c.cfg
+	if cfg.BeforeConnect != nil {
+		cfg = cfg.Clone()
+		if err = cfg.BeforeConnect(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Connect to Server
+	var mc *mysqlConn
+	var authData []byte
+	var plugin string
+	if cfg.Net != netSRV && c.hosts != nil {
+		mc, authData, plugin, err = c.dialHosts(ctx, cfg)
+	} else {
+		var conn net.Conn
+		if cfg.Net == netSRV {
+			conn, cfg, err = dialSRV(ctx, cfg)
+		} else {
+			conn, err = dial(ctx, cfg, cfg.Addr)
+		}
+		if err == nil {
+			mc, authData, plugin, err = startConn(ctx, cfg, conn)
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
+	defer mc.finish()
 
 	if plugin == "" {
 		plugin = defaultAuthPlugin
@@ -115,12 +194,37 @@ func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
 		mc.cleanup()
 		return nil, err
 	}
+	mc.authData = authData
+	mc.authPlugin = plugin
+
+	// Switch to the compressed protocol once the handshake is done
+	if mc.flags&clientCompress != 0 {
+		mc.compIO = newCompIO(mc)
+	}
 
+	// In sandbox mode all statements but SET and ALTER USER fail until the
+	// expired password was changed. The query of max_allowed_packet is the
+	// first statement, so it tells if the password expired.
+	sandbox := mc.flags&clientCanHandleExpiredPasswords != 0
 	if mc.cfg.MaxAllowedPacket > 0 {
 		mc.maxAllowedPacket = mc.cfg.MaxAllowedPacket
+		if sandbox {
+			if err = mc.exec("DO 1"); mustChangePassword(err) {
+				err = c.handleExpiredPassword(ctx, mc)
+			}
+			if err != nil {
+				mc.Close()
+				return nil, err
+			}
+		}
 	} else {
 		// Get max allowed packet size
 		maxap, err := mc.getSystemVar("max_allowed_packet")
+		if sandbox && mustChangePassword(err) {
+			if err = c.handleExpiredPassword(ctx, mc); err == nil {
+				maxap, err = mc.getSystemVar("max_allowed_packet")
+			}
+		}
 		if err != nil {
 			mc.Close()
 			return nil, err
@@ -138,6 +242,13 @@ func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
 		return nil, err
 	}
 
+	if mc.cfg.AfterConnect != nil {
+		if err = mc.cfg.AfterConnect(ctx, initConn{mc}); err != nil {
+			mc.Close()
+			return nil, err
+		}
+	}
+
 	return mc, nil
 }
 
@@ -1,14 +1,34 @@
 package mysql
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
 
+// testHandshake is the handshake of a MySQL 5.5.8 server with connection id
+// 165, which offers mysql_native_password
+var testHandshake = []byte{72, 0, 0, 0, 10, 53, 46, 53, 46, 56, 0, 165, 0, 0, 0,
+	60, 70, 63, 58, 68, 104, 34, 97, 0, 223, 247, 33, 2, 0, 15, 128, 21, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 98, 120, 114, 47, 85, 75, 109, 99, 51, 77,
+	50, 64, 0, 109, 121, 115, 113, 108, 95, 110, 97, 116, 105, 118, 101, 95,
+	112, 97, 115, 115, 119, 111, 114, 100}
+
+// newHandshakeMockConn returns a mockConn which accepts the authentication
+func newHandshakeMockConn(replies ...[]byte) *mockConn {
+	return &mockConn{
+		data:          testHandshake,
+		queuedReplies: append([][]byte{{7, 0, 0, 2, iOK, 0, 0, 2, 0, 0, 0}}, replies...),
+	}
+}
+
 func TestConnectorReturnsTimeout(t *testing.T) {
-	connector := &connector{&Config{
+	connector := &connector{cfg: &Config{
 		Net:     "tcp",
 		Addr:    "1.1.1.1:1234",
 		Timeout: 10 * time.Millisecond,
@@ -28,3 +48,259 @@ func TestConnectorReturnsTimeout(t *testing.T) {
 		t.Fatalf("expected %T, got %T", nerr, err)
 	}
 }
+
+func TestConnectorBeforeConnect(t *testing.T) {
+	var conn *mockConn
+	RegisterDialContext("beforeconnect", func(ctx context.Context, addr string) (net.Conn, error) {
+		conn = newHandshakeMockConn()
+		return conn, nil
+	})
+
+	cfg := NewConfig()
+	cfg.Net = "beforeconnect"
+	cfg.User = "static"
+	tokens := 0
+	cfg.BeforeConnect = func(ctx context.Context, cfg *Config) error {
+		tokens++
+		cfg.User = "rotated"
+		cfg.Passwd = "token"
+		return nil
+	}
+	c := &connector{cfg: cfg}
+
+	for i := 0; i < 2; i++ {
+		mc, err := c.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(conn.written, []byte("rotated\x00")) {
+			t.Errorf("the user of BeforeConnect was not sent: %q", conn.written)
+		}
+		mc.Close()
+	}
+	if tokens != 2 {
+		t.Errorf("expected BeforeConnect to be called for every connection, was called %d times", tokens)
+	}
+	if cfg.User != "static" || cfg.Passwd != "" {
+		t.Error("BeforeConnect modified the config of the connector")
+	}
+
+	// errors abort the connection attempt
+	errToken := errors.New("token expired")
+	cfg.BeforeConnect = func(ctx context.Context, cfg *Config) error {
+		return errToken
+	}
+	if _, err := c.Connect(context.Background()); err != errToken {
+		t.Errorf("expected the error of BeforeConnect, got %v", err)
+	}
+}
+
+func TestConnectorChangeExpiredPassword(t *testing.T) {
+	// server which supports CLIENT_CAN_HANDLE_EXPIRED_PASSWORDS
+	handshake := append([]byte(nil), testHandshake...)
+	handshake[29] |= byte(clientCanHandleExpiredPasswords >> 16)
+
+	mustChange := []byte{iERR, 0x1c, 0x07, '#', 'H', 'Y', '0', '0', '0', 'e', 'x', 'p', 'i', 'r', 'e', 'd'}
+	okPkt := []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+	var conn *mockConn
+	RegisterDialContext("expiredpassword", func(ctx context.Context, addr string) (net.Conn, error) {
+		conn = newHandshakeMockConn(appendTestPacket(nil, 1, mustChange), okPkt)
+		conn.data = handshake
+		return conn, nil
+	})
+
+	cfg := NewConfig()
+	cfg.Net = "expiredpassword"
+	cfg.User = "service"
+	cfg.Passwd = "old"
+	cfg.ChangeExpiredPassword = func(ctx context.Context, cfg *Config) (string, error) {
+		return "new'pass", nil
+	}
+	c, err := (&connector{cfg: cfg}).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	flags := clientFlag(binary.LittleEndian.Uint32(conn.written[4:8]))
+	if flags&clientCanHandleExpiredPasswords == 0 {
+		t.Error("CLIENT_CAN_HANDLE_EXPIRED_PASSWORDS was not requested")
+	}
+	if !bytes.Contains(conn.written, []byte(`ALTER USER CURRENT_USER() IDENTIFIED BY 'new\'pass'`)) {
+		t.Errorf("the password was not changed: %q", conn.written)
+	}
+	if mc := c.(*mysqlConn); mc.cfg.Passwd != "new'pass" || cfg.Passwd != "old" {
+		t.Errorf("unexpected passwords: connection %q, connector %q", mc.cfg.Passwd, cfg.Passwd)
+	}
+
+	// the callback is not called if the password has not expired
+	RegisterDialContext("expiredpassword", func(ctx context.Context, addr string) (net.Conn, error) {
+		conn = newHandshakeMockConn(okPkt)
+		conn.data = handshake
+		return conn, nil
+	})
+	cfg.ChangeExpiredPassword = func(ctx context.Context, cfg *Config) (string, error) {
+		t.Error("ChangeExpiredPassword was called")
+		return "", nil
+	}
+	c2, err := (&connector{cfg: cfg}).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2.Close()
+}
+
+func TestConnectorChangeExpiredPasswordMaxAllowedPacket(t *testing.T) {
+	handshake := append([]byte(nil), testHandshake...)
+	handshake[29] |= byte(clientCanHandleExpiredPasswords >> 16)
+
+	mustChange := []byte{iERR, 0x1c, 0x07, '#', 'H', 'Y', '0', '0', '0', 'e', 'x', 'p', 'i', 'r', 'e', 'd'}
+	okPkt := []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+	var maxAllowedPacket []byte
+	maxAllowedPacket = appendTestPacket(maxAllowedPacket, 1, []byte{1})
+	maxAllowedPacket = appendTestPacket(maxAllowedPacket, 2, testColumnDefinition("@@max_allowed_packet", fieldTypeLongLong))
+	maxAllowedPacket = appendTestPacket(maxAllowedPacket, 3, []byte{iEOF, 0, 0, 2, 0})
+	maxAllowedPacket = appendTestPacket(maxAllowedPacket, 4, append([]byte{7}, "4194304"...))
+	maxAllowedPacket = appendTestPacket(maxAllowedPacket, 5, []byte{iEOF, 0, 0, 2, 0})
+
+	var conn *mockConn
+	RegisterDialContext("expiredpasswordmap", func(ctx context.Context, addr string) (net.Conn, error) {
+		conn = newHandshakeMockConn(appendTestPacket(nil, 1, mustChange), okPkt, maxAllowedPacket)
+		conn.data = handshake
+		return conn, nil
+	})
+
+	cfg := NewConfig()
+	cfg.Net = "expiredpasswordmap"
+	cfg.MaxAllowedPacket = 0
+	cfg.ChangeExpiredPassword = func(ctx context.Context, cfg *Config) (string, error) {
+		return "new", nil
+	}
+	c, err := (&connector{cfg: cfg}).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// the query of max_allowed_packet checks the password
+	if bytes.Contains(conn.written, []byte("DO 1")) {
+		t.Errorf("the password was checked with an extra statement: %q", conn.written)
+	}
+	if !bytes.Contains(conn.written, []byte("ALTER USER CURRENT_USER() IDENTIFIED BY 'new'")) {
+		t.Errorf("the password was not changed: %q", conn.written)
+	}
+	if mc := c.(*mysqlConn); mc.maxAllowedPacket != 4194303 {
+		t.Errorf("unexpected max_allowed_packet %d", mc.maxAllowedPacket)
+	}
+}
+
+func TestConnectorChangeExpiredPasswordOnce(t *testing.T) {
+	handshake := append([]byte(nil), testHandshake...)
+	handshake[29] |= byte(clientCanHandleExpiredPasswords >> 16)
+
+	mustChange := []byte{iERR, 0x1c, 0x07, '#', 'H', 'Y', '0', '0', '0', 'e', 'x', 'p', 'i', 'r', 'e', 'd'}
+	okPkt := []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+	var conn *mockConn
+	RegisterDialContext("expiredpasswordonce", func(ctx context.Context, addr string) (net.Conn, error) {
+		// the reply to ALTER USER or COM_CHANGE_USER
+		conn = newHandshakeMockConn(appendTestPacket(nil, 1, mustChange), okPkt)
+		conn.data = handshake
+		return conn, nil
+	})
+
+	cfg := NewConfig()
+	cfg.Net = "expiredpasswordonce"
+	cfg.User = "service"
+	cfg.Passwd = "old"
+	calls := 0
+	cfg.ChangeExpiredPassword = func(ctx context.Context, cfg *Config) (string, error) {
+		calls++
+		return "new", nil
+	}
+	c := &connector{cfg: cfg}
+	for i := 0; i < 2; i++ {
+		mc, err := c.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if passwd := mc.(*mysqlConn).cfg.Passwd; passwd != "new" {
+			t.Errorf("connection %d: expected the new password, got %q", i, passwd)
+		}
+		mc.Close()
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call of ChangeExpiredPassword, got %d", calls)
+	}
+
+	// the second connection authenticates again with the new password
+	if bytes.Contains(conn.written, []byte("ALTER USER")) {
+		t.Errorf("the password was changed again: %q", conn.written)
+	}
+	if !bytes.Contains(conn.written, []byte{comChangeUser, 's', 'e', 'r', 'v', 'i', 'c', 'e', 0}) {
+		t.Errorf("COM_CHANGE_USER was not sent: %q", conn.written)
+	}
+}
+
+func TestConnectorAfterConnect(t *testing.T) {
+	okPkt := []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+	var conn *mockConn
+	RegisterDialContext("afterconnect", func(ctx context.Context, addr string) (net.Conn, error) {
+		conn = newHandshakeMockConn(okPkt)
+		return conn, nil
+	})
+
+	cfg := NewConfig()
+	cfg.Net = "afterconnect"
+	var version string
+	cfg.AfterConnect = func(ctx context.Context, conn InitConn) error {
+		version = conn.ServerVersion()
+		_, err := conn.Exec("SET ROLE ?", "app_reader")
+		return err
+	}
+	c, err := (&connector{cfg: cfg}).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if version != "5.5.8" {
+		t.Errorf("expected server version 5.5.8, got %q", version)
+	}
+	if !bytes.Contains(conn.written, []byte("SET ROLE 'app_reader'")) {
+		t.Errorf("the statement of AfterConnect was not run: %q", conn.written)
+	}
+
+	// errors fail the connection
+	errGrants := errors.New("missing grants")
+	cfg.AfterConnect = func(ctx context.Context, conn InitConn) error {
+		return errGrants
+	}
+	if _, err = (&connector{cfg: cfg}).Connect(context.Background()); err != errGrants {
+		t.Errorf("expected the error of AfterConnect, got %v", err)
+	}
+	if !conn.closed {
+		t.Error("the connection was not closed")
+	}
+}
+
+func TestInitConnInterpolate(t *testing.T) {
+	_, mc := newRWMockConn(0)
+	ic := initConn{mc}
+
+	query, err := ic.interpolate("SET ROLE ?", []interface{}{"app_reader"})
+	if err != nil || query != "SET ROLE 'app_reader'" {
+		t.Errorf("got %q, %v", query, err)
+	}
+
+	if _, err = ic.interpolate("SET ROLE ?, ?", []interface{}{"app_reader"}); err == nil ||
+		err.Error() != "mysql: 1 arguments for 2 placeholders" {
+		t.Errorf("expected an error for the number of arguments, got %v", err)
+	}
+	if _, err = ic.interpolate("SET @a = ?", []interface{}{strings.NewReader("a")}); err == nil ||
+		!strings.Contains(err.Error(), "io.Reader") {
+		t.Errorf("expected an error for the io.Reader, got %v", err)
+	}
+	mc.maxAllowedPacket = 16
+	if _, err = ic.interpolate("SET @a = ?", []interface{}{"a long value"}); err != ErrPktTooLarge {
+		t.Errorf("expected ErrPktTooLarge, got %v", err)
+	}
+}
@@ -14,6 +14,9 @@ const (
 	minProtocolVersion      = 10
 	maxPacketSize           = 1<<24 - 1
 	timeFormat              = "2006-01-02 15:04:05.999999"
+
+	// driverVersion is bumped with every release, along with CHANGELOG.md
+	driverVersion = "1.5.0"
 )
 
 // MySQL constants documentation:
@@ -24,6 +27,7 @@ const (
 	iOK           byte = 0x00		//ok 包括 PREPARE_OK
 
 	iAuthMoreData byte = 0x01		//
+	iAuthNextFactor byte = 0x02 // multi-factor authentication
 	iLocalInFile  byte = 0xfb
 
 	iEOF          byte = 0xfe
@@ -60,6 +64,10 @@ const (
 	clientCanHandleExpiredPasswords
 	clientSessionTrack
 	clientDeprecateEOF
+	clientOptionalResultsetMetadata
+	clientZstdCompressionAlgorithm
+	clientQueryAttributes
+	clientMultiFactorAuthentication
 )
 
 //命令列表 https://dev.mysql.com/doc/internals/en/text-protocol.html
@@ -93,6 +101,19 @@ const (
 	comStmtReset				//清楚预处理语句参数缓存
 	comSetOption				//设置语句选项
 	comStmtFetch				//获取预处理语句的执行结果
+	comDaemon					// (服务器内部命令)
+	comBinlogDumpGTID			//基于 GTID 获取二进制日志
+	comResetConnection			//重置会话状态
+)
+
+// cursor types of COM_STMT_EXECUTE
+// https://dev.mysql.com/doc/internals/en/com-stmt-execute.html
+const (
+	cursorTypeNoCursor byte = 0x00
+	cursorTypeReadOnly byte = 0x01
+
+	// the parameter count is sent, with CLIENT_QUERY_ATTRIBUTES
+	parameterCountAvailable byte = 0x08
 )
 
 // https://dev.mysql.com/doc/internals/en/com-query-response.html#packet-Protocol::ColumnType
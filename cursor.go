@@ -0,0 +1,207 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+)
+
+type fetchSizeKey struct{}
+
+// WithFetchSize returns a copy of ctx which makes queries run with it read
+// their rows from a read-only server-side cursor, n rows at a time.
+//
+// Each batch is fetched with COM_STMT_FETCH when the previous one has been
+// consumed, so large result sets do not have to be read at once and other
+// statements can run on the same connection while the rows are open.
+// Queries without arguments are prepared for this. A fetch size <= 0
+// disables cursors.
+//
+//	rows, err := db.QueryContext(mysql.WithFetchSize(ctx, 1000), "SELECT * FROM big")
+func WithFetchSize(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, fetchSizeKey{}, n)
+}
+
+func fetchSizeFromContext(ctx context.Context) int {
+	n, _ := ctx.Value(fetchSizeKey{}).(int)
+	return n
+}
+
+// openCursor executes the statement with a read-only cursor.
+// If the server did not open a cursor, e.g. because the statement does not
+// return rows, the rows are read from the stream like with query.
+func (stmt *mysqlStmt) openCursor(args []driver.Value, fetchSize int) (*binaryRows, error) {
+	if stmt.mc.closed.IsSet() {
+		errLog.Print(ErrInvalidConn)
+		return nil, driver.ErrBadConn
+	}
+	// Send command
+	err := stmt.writeExecutePacket(args, cursorTypeReadOnly)
+	if err != nil {
+		return nil, stmt.mc.markBadConn(err)
+	}
+
+	mc := stmt.mc
+
+	// Read Result
+	resLen, err := mc.readResultSetHeaderPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := new(binaryRows)
+
+	if resLen == 0 {
+		rows.rs.done = true
+
+		switch err := rows.NextResultSet(); err {
+		case nil, io.EOF:
+			return rows, nil
+		default:
+			return nil, err
+		}
+	}
+
+	rows.mc = mc
+	if rows.rs.columns, err = mc.readColumns(resLen); err != nil {
+		return nil, err
+	}
+
+	// With CLIENT_DEPRECATE_EOF the column definitions are only terminated
+	// if a cursor was opened. Otherwise this is already the first row or the
+	// end of the empty result set.
+	if mc.flags&clientDeprecateEOF != 0 {
+		data, err := mc.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case data[0] == iOK:
+			row := make([]byte, len(data))
+			copy(row, data)
+			rows.fetched = append(rows.fetched, row)
+			return rows, nil
+		case mc.isEOFPacket(data):
+			// the status of the packet tells if a cursor was opened
+			if err := mc.handleEOFPacket(data); err != nil {
+				return nil, err
+			}
+			if mc.status&statusCursorExists == 0 {
+				if err := rows.handleEOF(data); err != io.EOF {
+					return nil, err
+				}
+				return rows, nil
+			}
+		default:
+			return nil, mc.handleErrorPacket(data)
+		}
+	}
+
+	if mc.status&statusCursorExists != 0 {
+		rows.stmt = stmt
+		rows.fetchSize = fetchSize
+	}
+	return rows, nil
+}
+
+// fetchRow returns the next row of a cursor. A new batch is fetched from the
+// server once all buffered rows were returned.
+func (rows *binaryRows) fetchRow(dest []driver.Value) error {
+	if len(rows.fetched) == 0 {
+		if rows.stmt == nil {
+			// the first row was already read, the rest follows in the stream
+			return rows.readRow(dest)
+		}
+		if rows.rs.done {
+			rows.mc = nil
+			return io.EOF
+		}
+		if err := rows.fetch(); err != nil {
+			return err
+		}
+		if len(rows.fetched) == 0 {
+			rows.mc = nil
+			return io.EOF
+		}
+	}
+
+	data := rows.fetched[0]
+	rows.fetched[0] = nil
+	rows.fetched = rows.fetched[1:]
+	return rows.decodeRow(data, dest)
+}
+
+// fetch reads the next batch of rows from the cursor into rows.fetched.
+// The whole batch is read, so the connection is idle again afterwards.
+func (rows *binaryRows) fetch() error {
+	mc := rows.mc
+	if err := mc.watchCancel(rows.ctx); err != nil {
+		return err
+	}
+	defer mc.finish()
+
+	if err := rows.stmt.writeFetchPacket(rows.fetchSize); err != nil {
+		return mc.markBadConn(err)
+	}
+
+	for {
+		data, err := mc.readPacket()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case data[0] == iOK:
+			// the read buffer is reused, copy the row
+			row := make([]byte, len(data))
+			copy(row, data)
+			rows.fetched = append(rows.fetched, row)
+
+		case mc.isEOFPacket(data):
+			if err := mc.handleEOFPacket(data); err != nil {
+				return err
+			}
+			rows.rs.setTrailer(mc)
+			if mc.status&statusLastRowSent != 0 || mc.status&statusCursorExists == 0 {
+				rows.rs.done = true
+			}
+			return nil
+
+		default:
+			return mc.handleErrorPacket(data)
+		}
+	}
+}
+
+// Close closes the cursor with COM_STMT_RESET if not all rows were fetched.
+func (rows *binaryRows) Close() error {
+	if rows.stmt == nil {
+		return rows.mysqlRows.Close()
+	}
+
+	mc := rows.mc
+	rows.fetched = nil
+	if mc == nil {
+		return nil
+	}
+	rows.mc = nil
+	if err := mc.error(); err != nil {
+		return err
+	}
+	if rows.rs.done {
+		return nil
+	}
+
+	if err := mc.writeCommandPacketUint32(comStmtReset, rows.stmt.id); err != nil {
+		return err
+	}
+	return mc.readResultOK()
+}
@@ -0,0 +1,139 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// cursorReplies returns the reply to COM_STMT_EXECUTE opening a cursor over
+// one BIGINT column and the replies to two COM_STMT_FETCH with 2 and 1 rows.
+// With deprecateEOF the EOF packets are OK packets with the EOF header.
+func cursorReplies(deprecateEOF bool) [][]byte {
+	row := func(v byte) []byte {
+		// header, NULL-bitmap, value
+		return []byte{iOK, 0, v, 0, 0, 0, 0, 0, 0, 0}
+	}
+	eof := func(status statusFlag) []byte {
+		if deprecateEOF {
+			// affected rows, insert id, status, warnings
+			return []byte{iEOF, 0, 0, byte(status), byte(status >> 8), 0, 0}
+		}
+		return []byte{iEOF, 0, 0, byte(status), byte(status >> 8)}
+	}
+
+	var execute, batch1, batch2 []byte
+	execute = appendTestPacket(execute, 1, []byte{1})
+	execute = appendTestPacket(execute, 2, testColumnDefinition("id", fieldTypeLongLong))
+	execute = appendTestPacket(execute, 3, eof(statusInAutocommit|statusCursorExists))
+
+	batch1 = appendTestPacket(batch1, 1, row(1))
+	batch1 = appendTestPacket(batch1, 2, row(2))
+	batch1 = appendTestPacket(batch1, 3, eof(statusInAutocommit|statusCursorExists))
+
+	batch2 = appendTestPacket(batch2, 1, row(3))
+	batch2 = appendTestPacket(batch2, 2, eof(statusInAutocommit|statusCursorExists|statusLastRowSent))
+
+	return [][]byte{execute, batch1, batch2}
+}
+
+func TestCursorFetch(t *testing.T) {
+	testCursorFetch(t, false)
+}
+
+func TestCursorFetchDeprecateEOF(t *testing.T) {
+	testCursorFetch(t, true)
+}
+
+func testCursorFetch(t *testing.T, deprecateEOF bool) {
+	conn, mc := newRWMockConn(0)
+	if deprecateEOF {
+		mc.flags |= clientDeprecateEOF
+	}
+	conn.queuedReplies = cursorReplies(deprecateEOF)
+	stmt := &mysqlStmt{mc: mc, id: 7}
+
+	ctx := WithFetchSize(context.Background(), 2)
+	rows, err := stmt.QueryContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// COM_STMT_EXECUTE with CURSOR_TYPE_READ_ONLY
+	if conn.written[4] != comStmtExecute || conn.written[9] != cursorTypeReadOnly {
+		t.Fatalf("unexpected execute packet: %v", conn.written)
+	}
+
+	dest := make([]driver.Value, 1)
+	for i := int64(1); i <= 3; i++ {
+		if err := rows.Next(dest); err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if dest[0] != i {
+			t.Errorf("row %d: got %v", i, dest[0])
+		}
+
+		// COM_STMT_FETCH statement 7, 2 rows
+		if i == 1 || i == 3 {
+			fetch := conn.written[len(conn.written)-13:]
+			if fetch[4] != comStmtFetch || binary.LittleEndian.Uint32(fetch[5:]) != 7 ||
+				binary.LittleEndian.Uint32(fetch[9:]) != 2 {
+				t.Errorf("row %d: unexpected fetch packet: %v", i, fetch)
+			}
+		}
+	}
+
+	written := len(conn.written)
+	if err := rows.Next(dest); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.written) != written {
+		t.Errorf("unexpected packets after the last row: %v", conn.written[written:])
+	}
+}
+
+func TestCursorCloseEarly(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	replies := cursorReplies(false)
+	// reply to COM_STMT_RESET
+	conn.queuedReplies = [][]byte{replies[0], replies[1], {7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}}
+	stmt := &mysqlStmt{mc: mc, id: 7}
+
+	rows, err := stmt.QueryContext(WithFetchSize(context.Background(), 2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reset := conn.written[len(conn.written)-9:]
+	if reset[4] != comStmtReset || binary.LittleEndian.Uint32(reset[5:]) != 7 {
+		t.Errorf("unexpected reset packet: %v", reset)
+	}
+}
+
+func TestQueryContextFetchSizeSkip(t *testing.T) {
+	_, mc := newRWMockConn(0)
+	_, err := mc.QueryContext(WithFetchSize(context.Background(), 10), "SELECT 1", nil)
+	if err != driver.ErrSkip {
+		t.Errorf("expected driver.ErrSkip, got %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Networks of the proxies connections can be tunneled through, e.g.
+// socks5(proxy:1080)/tcp(db:3306)
+const (
+	proxyNetSOCKS5      = "socks5"
+	proxyNetHTTPConnect = "httpconnect"
+)
+
+// defaultProxyPorts are used for proxy addresses without port
+var defaultProxyPorts = map[string]string{
+	proxyNetSOCKS5:      "1080",
+	proxyNetHTTPConnect: "3128",
+}
+
+func isProxyNet(network string) bool {
+	return network == proxyNetSOCKS5 || network == proxyNetHTTPConnect
+}
+
+// splitProxyAddr splits the address parsed from proxy(proxyaddr)/net(addr)
+// into the address of the proxy and the network and address of the server.
+func splitProxyAddr(addr string) (proxyAddr, network, serverAddr string, err error) {
+	i := strings.Index(addr, ")/")
+	if i < 0 {
+		return "", "", "", errors.New("invalid DSN: missing the server address behind the proxy")
+	}
+	proxyAddr, server := addr[:i], addr[i+2:]
+	j := strings.IndexByte(server, '(')
+	if j < 0 {
+		return "", "", "", errors.New("invalid DSN: missing the server address behind the proxy")
+	}
+	return proxyAddr, server[:j], server[j+1:], nil
+}
+
+// dialProxy connects to addr through the proxy of the config.
+func dialProxy(ctx context.Context, cfg *Config, addr string) (net.Conn, error) {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	var nd net.Dialer
+	conn, err := nd.DialContext(ctx, "tcp", cfg.ProxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// abort the handshake with the proxy when ctx is done
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	if cfg.ProxyNet == proxyNetSOCKS5 {
+		err = socks5Connect(conn, addr, cfg.ProxyUser, cfg.ProxyPasswd)
+	} else {
+		err = httpConnect(conn, addr, cfg.ProxyUser, cfg.ProxyPasswd)
+	}
+
+	// the goroutine must not set its deadline after it was cleared
+	close(done)
+	<-stopped
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		conn.Close()
+		// The deadlines of conn are those of ctx. Its timer can fire a bit
+		// after the read timed out.
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			<-ctx.Done()
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// socks5Connect requests a connection to addr from a SOCKS5 proxy.
+// https://tools.ietf.org/html/rfc1928
+// https://tools.ietf.org/html/rfc1929
+func socks5Connect(conn net.Conn, addr, user, passwd string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	// greeting with the supported authentication methods
+	method := byte(0x00) // no authentication
+	if user != "" {
+		method = 0x02 // username / password
+	}
+	if _, err = conn.Write([]byte{0x05, 1, method}); err != nil {
+		return err
+	}
+	var resp [2]byte
+	if _, err = io.ReadFull(conn, resp[:]); err != nil {
+		return err
+	}
+	if resp[0] != 0x05 || resp[1] != method {
+		return errors.New("socks5: proxy does not accept the authentication method")
+	}
+
+	if method == 0x02 {
+		if len(user) > 255 || len(passwd) > 255 {
+			return errors.New("socks5: username or password too long")
+		}
+		req := []byte{0x01, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(passwd)))
+		req = append(req, passwd...)
+		if _, err = conn.Write(req); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, resp[:]); err != nil {
+			return err
+		}
+		if resp[1] != 0x00 {
+			return errors.New("socks5: authentication failed")
+		}
+	}
+
+	// CONNECT request
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, 0x01)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	// reply, followed by the bound address
+	var reply [4]byte
+	if _, err = io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0x00 {
+		return errors.New("socks5: connect failed with reply code " + strconv.Itoa(int(reply[1])))
+	}
+	var n int
+	switch reply[3] {
+	case 0x01:
+		n = net.IPv4len
+	case 0x04:
+		n = net.IPv6len
+	case 0x03:
+		var l [1]byte
+		if _, err = io.ReadFull(conn, l[:]); err != nil {
+			return err
+		}
+		n = int(l[0])
+	default:
+		return errors.New("socks5: unknown address type in reply")
+	}
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
+
+// httpConnect requests a tunnel to addr from an HTTP proxy.
+func httpConnect(conn net.Conn, addr, user, passwd string) error {
+	var req bytes.Buffer
+	req.WriteString("CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n")
+	if user != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + passwd))
+		req.WriteString("Proxy-Authorization: Basic " + auth + "\r\n")
+	}
+	req.WriteString("\r\n")
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return err
+	}
+
+	// Read the response byte by byte, since the server may send its
+	// handshake right after it.
+	var resp []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(resp, []byte("\r\n\r\n")) {
+		if len(resp) > 8192 {
+			return errors.New("httpconnect: response header too long")
+		}
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return err
+		}
+		resp = append(resp, b[0])
+	}
+
+	// HTTP/1.1 200 Connection established
+	status := string(resp[:bytes.IndexByte(resp, '\r')])
+	fields := strings.SplitN(status, " ", 3)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return errors.New("httpconnect: malformed response: " + status)
+	}
+	if fields[1] != "200" {
+		return errors.New("httpconnect: proxy refused the connection: " + status)
+	}
+	return nil
+}
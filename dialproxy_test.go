@@ -0,0 +1,179 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDSNProxy(t *testing.T) {
+	dsn := "user:pass@socks5(bastion:1080)/tcp(db.internal:3306)/dbname?proxyPassword=s%3Acret&proxyUser=jump"
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ProxyNet != "socks5" || cfg.ProxyAddr != "bastion:1080" || cfg.Net != "tcp" || cfg.Addr != "db.internal:3306" {
+		t.Errorf("unexpected addresses: %s(%s)/%s(%s)", cfg.ProxyNet, cfg.ProxyAddr, cfg.Net, cfg.Addr)
+	}
+	if cfg.User != "user" || cfg.Passwd != "pass" || cfg.ProxyUser != "jump" || cfg.ProxyPasswd != "s:cret" {
+		t.Errorf("unexpected credentials: %q %q %q %q", cfg.User, cfg.Passwd, cfg.ProxyUser, cfg.ProxyPasswd)
+	}
+	if cfg.FormatDSN() != dsn {
+		t.Errorf("FormatDSN: expected %q, got %q", dsn, cfg.FormatDSN())
+	}
+
+	for _, dsn := range []string{
+		"httpconnect(proxy:3128)/dbname",             // no server address
+		"httpconnect(proxy:3128)/unix(/tmp/s)/",      // not tcp
+		"httpconnect(proxy:3128)/tcp(db:3306/dbname", // unterminated server address
+		"socks5()/tcp(db:3306)/",                     // no proxy address
+		"socks5(proxy:1080)/tcp(db:3306)/?proxyProtocol=v1",
+	} {
+		if _, err := ParseDSN(dsn); err == nil {
+			t.Errorf("expected an error for %q", dsn)
+		}
+	}
+
+	// default ports of the proxies
+	for dsn, addr := range map[string]string{
+		"socks5(bastion)/tcp(db:3306)/":    "bastion:1080",
+		"httpconnect(proxy)/tcp(db:3306)/": "proxy:3128",
+	} {
+		cfg, err := ParseDSN(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.ProxyAddr != addr {
+			t.Errorf("%q: expected proxy address %q, got %q", dsn, addr, cfg.ProxyAddr)
+		}
+	}
+}
+
+func TestSOCKS5Connect(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		defer server.Close()
+		var req []byte
+		buf := make([]byte, 64)
+		for _, reply := range [][]byte{
+			{0x05, 0x02}, // username / password
+			{0x01, 0x00}, // authenticated
+			{0x05, 0x00, 0x00, 0x01, 10, 0, 0, 1, 0x12, 0x34},
+		} {
+			n, _ := server.Read(buf)
+			req = append(req, buf[:n]...)
+			server.Write(reply)
+		}
+		received <- req
+	}()
+
+	if err := socks5Connect(client, "db.internal:3306", "jump", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x05, 1, 0x02, 0x01, 4, 'j', 'u', 'm', 'p', 2, 'p', 'w',
+		0x05, 0x01, 0x00, 0x03, 11, 'd', 'b', '.', 'i', 'n', 't', 'e', 'r', 'n', 'a', 'l', 0x0c, 0xea}
+	if req := <-received; !bytes.Equal(req, expected) {
+		t.Errorf("unexpected requests:\n%v\n%v", req, expected)
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	received := make(chan string, 1)
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		var req strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			req.WriteString(line)
+			if line == "\r\n" {
+				break
+			}
+		}
+		received <- req.String()
+		// the handshake of the server follows the response
+		server.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nhandshake"))
+	}()
+
+	if err := httpConnect(client, "db:3306", "jump", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "CONNECT db:3306 HTTP/1.1\r\nHost: db:3306\r\nProxy-Authorization: Basic anVtcDpwdw==\r\n\r\n"
+	if req := <-received; req != expected {
+		t.Errorf("unexpected request %q", req)
+	}
+	rest, _ := ioutil.ReadAll(client)
+	if string(rest) != "handshake" {
+		t.Errorf("the data behind the response was consumed: %q", rest)
+	}
+
+	// errors of the proxy
+	client, server = net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		io.ReadFull(server, make([]byte, len("CONNECT db:3306 HTTP/1.1\r\nHost: db:3306\r\n\r\n")))
+		server.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+	}()
+	if err := httpConnect(client, "db:3306", "", ""); err == nil || !strings.Contains(err.Error(), "407") {
+		t.Errorf("expected the status of the proxy, got %v", err)
+	}
+}
+
+func TestDialProxyTimeout(t *testing.T) {
+	// a proxy which never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cfg := NewConfig()
+	cfg.ProxyNet = proxyNetSOCKS5
+	cfg.ProxyAddr = ln.Addr().String()
+	cfg.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err = dial(context.Background(), cfg, "db:3306"); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("the timeout was not applied")
+	}
+
+	cfg.Timeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err = dial(ctx, cfg, "db:3306"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -10,6 +10,7 @@ package mysql
 
 import (
 	"bytes"
+	"context"
 	"crypto/rsa"
 	"crypto/tls"
 	"errors"
@@ -36,13 +37,21 @@ var (
 type Config struct {
 	User             string            // Username
 	Passwd           string            // Password (requires User)
+	Passwd2          string            // Password of the second factor of multi-factor authentication
+	Passwd3          string            // Password of the third factor of multi-factor authentication
 	Net              string            // Network type
 	Addr             string            // Network address (requires Net)
+	ProxyNet         string            // Network of the proxy the connection is tunneled through: socks5 or httpconnect
+	ProxyAddr        string            // Address of the proxy (requires ProxyNet)
+	ProxyUser        string            // Username for the proxy
+	ProxyPasswd      string            // Password for the proxy (requires ProxyUser)
 	DBName           string            // Database name
 
 	Params           map[string]string // Connection parameters
 	Collation        string            // 排序规则 Connection collation
 
+	ConnectionAttributes string // Connection attributes, comma-separated key:value pairs
+
 	Loc              *time.Location    // Location for time.Time values
 
 	MaxAllowedPacket int               // 最大4<<20 4MB Max packet size allowed
@@ -51,12 +60,49 @@ type Config struct {
 	pubKey           *rsa.PublicKey    // Server public key
 
 	TLSConfig        string            // TLS configuration name
+	SSLMode          string            // DISABLED, PREFERRED, REQUIRED, VERIFY_CA or VERIFY_IDENTITY
 	tls              *tls.Config       // TLS configuration
 
+	TLSCA         string // Path of the PEM file with the CA certificates to verify the server
+	TLSCert       string // Path of the PEM file with the client certificate
+	TLSKey        string // Path of the PEM file with the key of the client certificate
+	TLSServerName string // Server name to verify the certificate against, defaults to the host
+	TLSMinVersion string // Minimum TLS version, e.g. TLS1.2
+	tlsFiles      *tlsFiles
+
+	WarningsAsErrors string // Minimum severity (note, warning, error) of warnings returned as error
+
+	ProxyProtocol   string // Version of the PROXY protocol header sent after dialing: v1 or v2
+	ProxySourceAddr string // Source address of the PROXY protocol header, defaults to the local address
+
+	HostPolicy  string        // Order of dialing multi-host addresses: sequential, random, round-robin or least-recently-failed
+	HostBackoff time.Duration // Initial time to skip a host of a multi-host address after it failed
+
 	Timeout          time.Duration     // Dial timeout
 	ReadTimeout      time.Duration     // I/O read timeout
 	WriteTimeout     time.Duration     // I/O write timeout
 
+	// BeforeConnect is called with a copy of the config before each new
+	// connection is established, e.g. to set a fresh password or auth token.
+	// It cannot be set in the DSN.
+	BeforeConnect func(ctx context.Context, cfg *Config) error
+
+	// AfterConnect is called after a new connection is established and
+	// before it is used, e.g. to run SET ROLE, and again after the session is
+	// reset with ResetSession. If it returns an error, the connection is
+	// closed. It cannot be set in the DSN.
+	AfterConnect func(ctx context.Context, conn InitConn) error
+
+	// ChangeExpiredPassword is called with a copy of the config if the
+	// password of the account has expired. It returns the new password, which
+	// the driver sets with ALTER USER before the connection is used. Calls
+	// for connections of the same connector are not concurrent. It cannot be
+	// set in the DSN.
+	ChangeExpiredPassword func(ctx context.Context, cfg *Config) (string, error)
+
+	CompressionLevel     int // zlib compression level (1-9), 0 uses the default level
+	CompressionThreshold int // Packets smaller than this are sent uncompressed, 0 uses the default of 50 bytes
+
 	AllowAllFiles           bool // Allow all files to be used with LOAD DATA LOCAL INFILE
 	AllowCleartextPasswords bool // Allows the cleartext client side plugin
 	AllowNativePasswords    bool // Allows the native password authentication method
@@ -64,10 +110,14 @@ type Config struct {
 	CheckConnLiveness       bool // Check connections for liveness before using them
 	ClientFoundRows         bool // Return number of matching rows instead of rows changed
 	ColumnsWithAlias        bool // Prepend table alias to column names
+	Compress                bool // Use the compressed protocol if the server supports it
+	FetchWarnings           bool // Fetch the warnings of statements with SHOW WARNINGS
 	InterpolateParams       bool // Interpolate placeholders into query string
+	KillQueryOnCancel       bool // Cancel running queries with KILL QUERY instead of closing the connection
 	MultiStatements         bool // Allow multiple statements in one query
 	ParseTime               bool // Parse time values to time.Time
 	RejectReadOnly          bool // Reject read-only connections
+	ResetSession            bool // Reset the session state when a connection is reused
 }
 
 // NewConfig creates a new Config and sets default values.
@@ -122,7 +172,45 @@ func (cfg *Config) normalize() error {
 			return errors.New("default addr for network '" + cfg.Net + "' unknown")
 		}
 	} else if cfg.Net == "tcp" {
-		cfg.Addr = ensureHavePort(cfg.Addr)
+		addrs := splitAddrs(cfg.Addr)
+		for i := range addrs {
+			addrs[i] = ensureHavePort(addrs[i])
+		}
+		cfg.Addr = strings.Join(addrs, ",")
+	}
+
+	switch cfg.ProxyProtocol {
+	case "", proxyProtocolV1, proxyProtocolV2:
+	default:
+		return errors.New("invalid PROXY protocol version: " + cfg.ProxyProtocol)
+	}
+	if cfg.ProxySourceAddr != "" {
+		if _, err := parseProxySourceAddr(cfg.ProxySourceAddr); err != nil {
+			return err
+		}
+	}
+
+	if cfg.ProxyNet != "" {
+		if !isProxyNet(cfg.ProxyNet) {
+			return errors.New("unknown proxy network: " + cfg.ProxyNet)
+		}
+		if cfg.Net != "tcp" && cfg.Net != netSRV {
+			return errors.New("only tcp connections can be tunneled through a proxy, not " + cfg.Net)
+		}
+		if cfg.ProxyAddr == "" {
+			return errors.New("missing proxy address")
+		}
+		if _, _, err := net.SplitHostPort(cfg.ProxyAddr); err != nil {
+			cfg.ProxyAddr = net.JoinHostPort(cfg.ProxyAddr, defaultProxyPorts[cfg.ProxyNet])
+		}
+		// the header would name the proxy as destination
+		if cfg.ProxyProtocol != "" {
+			return errors.New("proxyProtocol cannot be used with a " + cfg.ProxyNet + " proxy")
+		}
+	}
+
+	if !validHostPolicy(cfg.HostPolicy) {
+		return errors.New("invalid host policy: " + cfg.HostPolicy)
 	}
 
 	switch cfg.TLSConfig {
@@ -139,6 +227,18 @@ func (cfg *Config) normalize() error {
 		}
 	}
 
+	if cfg.SSLMode != "" {
+		if err := cfg.normalizeSSLMode(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.TLSCA != "" || cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.TLSServerName != "" || cfg.TLSMinVersion != "" {
+		if err := cfg.normalizeTLSParams(); err != nil {
+			return err
+		}
+	}
+
 	if cfg.tls != nil && cfg.tls.ServerName == "" && !cfg.tls.InsecureSkipVerify {
 		host, _, err := net.SplitHostPort(cfg.Addr)
 		if err == nil {
@@ -146,6 +246,18 @@ func (cfg *Config) normalize() error {
 		}
 	}
 
+	if cfg.CompressionLevel < -1 || cfg.CompressionLevel > 9 {
+		return errors.New("invalid compression level: " + strconv.Itoa(cfg.CompressionLevel))
+	}
+
+	if _, err := parseConnectionAttributes(cfg.ConnectionAttributes); err != nil {
+		return err
+	}
+
+	if cfg.WarningsAsErrors != "" && warningSeverity(cfg.WarningsAsErrors) == 0 {
+		return errors.New("invalid warning severity: " + cfg.WarningsAsErrors)
+	}
+
 	if cfg.ServerPubKey != "" {
 		cfg.pubKey = getServerPubKey(cfg.ServerPubKey)
 		if cfg.pubKey == nil {
@@ -156,6 +268,64 @@ func (cfg *Config) normalize() error {
 	return nil
 }
 
+// normalizeSSLMode sets up the TLS config for the ssl-mode. A registered TLS
+// config can be used as the base, e.g. for the CA certificates.
+func (cfg *Config) normalizeSSLMode() error {
+	switch cfg.TLSConfig {
+	case "", "false", "true", "skip-verify", "preferred":
+		if cfg.TLSConfig != "" {
+			return errors.New("ssl-mode can not be combined with tls=" + cfg.TLSConfig)
+		}
+		cfg.tls = &tls.Config{}
+	}
+
+	switch cfg.SSLMode {
+	case sslModeDisabled:
+		cfg.tls = nil
+	case sslModePreferred, sslModeRequired:
+		cfg.tls.InsecureSkipVerify = true
+	case sslModeVerifyCA, sslModeVerifyIdentity:
+		// the chain of VERIFY_CA is verified by Config.tlsConfig
+		cfg.tls.InsecureSkipVerify = false
+	default:
+		return errors.New("invalid ssl-mode: " + cfg.SSLMode)
+	}
+	return nil
+}
+
+// normalizeTLSParams applies the tls-* parameters to the TLS config. They
+// enable TLS with verification of the server certificate unless TLS is
+// configured otherwise.
+func (cfg *Config) normalizeTLSParams() error {
+	if cfg.tls == nil {
+		if cfg.TLSConfig == "false" || cfg.SSLMode == sslModeDisabled {
+			return errors.New("tls-* parameters can not be used with TLS disabled")
+		}
+		cfg.tls = &tls.Config{}
+	}
+
+	if cfg.TLSServerName != "" {
+		cfg.tls.ServerName = cfg.TLSServerName
+	}
+	if cfg.TLSMinVersion != "" {
+		version, err := parseTLSVersion(cfg.TLSMinVersion)
+		if err != nil {
+			return err
+		}
+		cfg.tls.MinVersion = version
+	}
+
+	cfg.tlsFiles = nil
+	if cfg.TLSCA != "" || cfg.TLSCert != "" || cfg.TLSKey != "" {
+		files, err := newTLSFiles(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return err
+		}
+		cfg.tlsFiles = files
+	}
+	return nil
+}
+
 func writeDSNParam(buf *bytes.Buffer, hasParam *bool, name, value string) {
 	buf.Grow(1 + len(name) + 1 + len(value))
 	if !*hasParam {
@@ -184,6 +354,14 @@ func (cfg *Config) FormatDSN() string {
 		buf.WriteByte('@')
 	}
 
+	// [proxy(address)/]
+	if len(cfg.ProxyNet) > 0 {
+		buf.WriteString(cfg.ProxyNet)
+		buf.WriteByte('(')
+		buf.WriteString(cfg.ProxyAddr)
+		buf.WriteString(")/")
+	}
+
 	// [protocol[(address)]]
 	if len(cfg.Net) > 0 {
 		buf.WriteString(cfg.Net)
@@ -234,10 +412,42 @@ func (cfg *Config) FormatDSN() string {
 		writeDSNParam(&buf, &hasParam, "columnsWithAlias", "true")
 	}
 
+	if cfg.Compress {
+		writeDSNParam(&buf, &hasParam, "compress", "true")
+	}
+
+	if cfg.CompressionLevel != 0 {
+		writeDSNParam(&buf, &hasParam, "compressionLevel", strconv.Itoa(cfg.CompressionLevel))
+	}
+
+	if cfg.CompressionThreshold > 0 {
+		writeDSNParam(&buf, &hasParam, "compressionThreshold", strconv.Itoa(cfg.CompressionThreshold))
+	}
+
+	if cfg.ConnectionAttributes != "" {
+		writeDSNParam(&buf, &hasParam, "connectionAttributes", url.QueryEscape(cfg.ConnectionAttributes))
+	}
+
+	if cfg.FetchWarnings {
+		writeDSNParam(&buf, &hasParam, "fetchWarnings", "true")
+	}
+
+	if cfg.HostBackoff > 0 {
+		writeDSNParam(&buf, &hasParam, "hostBackoff", cfg.HostBackoff.String())
+	}
+
+	if len(cfg.HostPolicy) > 0 {
+		writeDSNParam(&buf, &hasParam, "hostPolicy", cfg.HostPolicy)
+	}
+
 	if cfg.InterpolateParams {
 		writeDSNParam(&buf, &hasParam, "interpolateParams", "true")
 	}
 
+	if cfg.KillQueryOnCancel {
+		writeDSNParam(&buf, &hasParam, "killQueryOnCancel", "true")
+	}
+
 	if cfg.Loc != time.UTC && cfg.Loc != nil {
 		writeDSNParam(&buf, &hasParam, "loc", url.QueryEscape(cfg.Loc.String()))
 	}
@@ -250,6 +460,30 @@ func (cfg *Config) FormatDSN() string {
 		writeDSNParam(&buf, &hasParam, "parseTime", "true")
 	}
 
+	if len(cfg.Passwd2) > 0 {
+		writeDSNParam(&buf, &hasParam, "password2", url.QueryEscape(cfg.Passwd2))
+	}
+
+	if len(cfg.Passwd3) > 0 {
+		writeDSNParam(&buf, &hasParam, "password3", url.QueryEscape(cfg.Passwd3))
+	}
+
+	if len(cfg.ProxyProtocol) > 0 {
+		writeDSNParam(&buf, &hasParam, "proxyProtocol", cfg.ProxyProtocol)
+	}
+
+	if len(cfg.ProxyPasswd) > 0 {
+		writeDSNParam(&buf, &hasParam, "proxyPassword", url.QueryEscape(cfg.ProxyPasswd))
+	}
+
+	if len(cfg.ProxySourceAddr) > 0 {
+		writeDSNParam(&buf, &hasParam, "proxySourceAddr", url.QueryEscape(cfg.ProxySourceAddr))
+	}
+
+	if len(cfg.ProxyUser) > 0 {
+		writeDSNParam(&buf, &hasParam, "proxyUser", url.QueryEscape(cfg.ProxyUser))
+	}
+
 	if cfg.ReadTimeout > 0 {
 		writeDSNParam(&buf, &hasParam, "readTimeout", cfg.ReadTimeout.String())
 	}
@@ -258,10 +492,18 @@ func (cfg *Config) FormatDSN() string {
 		writeDSNParam(&buf, &hasParam, "rejectReadOnly", "true")
 	}
 
+	if cfg.ResetSession {
+		writeDSNParam(&buf, &hasParam, "resetSession", "true")
+	}
+
 	if len(cfg.ServerPubKey) > 0 {
 		writeDSNParam(&buf, &hasParam, "serverPubKey", url.QueryEscape(cfg.ServerPubKey))
 	}
 
+	if len(cfg.SSLMode) > 0 {
+		writeDSNParam(&buf, &hasParam, "ssl-mode", cfg.SSLMode)
+	}
+
 	if cfg.Timeout > 0 {
 		writeDSNParam(&buf, &hasParam, "timeout", cfg.Timeout.String())
 	}
@@ -270,6 +512,30 @@ func (cfg *Config) FormatDSN() string {
 		writeDSNParam(&buf, &hasParam, "tls", url.QueryEscape(cfg.TLSConfig))
 	}
 
+	if len(cfg.TLSCA) > 0 {
+		writeDSNParam(&buf, &hasParam, "tls-ca", url.QueryEscape(cfg.TLSCA))
+	}
+
+	if len(cfg.TLSCert) > 0 {
+		writeDSNParam(&buf, &hasParam, "tls-cert", url.QueryEscape(cfg.TLSCert))
+	}
+
+	if len(cfg.TLSKey) > 0 {
+		writeDSNParam(&buf, &hasParam, "tls-key", url.QueryEscape(cfg.TLSKey))
+	}
+
+	if len(cfg.TLSMinVersion) > 0 {
+		writeDSNParam(&buf, &hasParam, "tls-min-version", cfg.TLSMinVersion)
+	}
+
+	if len(cfg.TLSServerName) > 0 {
+		writeDSNParam(&buf, &hasParam, "tls-server-name", url.QueryEscape(cfg.TLSServerName))
+	}
+
+	if len(cfg.WarningsAsErrors) > 0 {
+		writeDSNParam(&buf, &hasParam, "warningsAsErrors", cfg.WarningsAsErrors)
+	}
+
 	if cfg.WriteTimeout > 0 {
 		writeDSNParam(&buf, &hasParam, "writeTimeout", cfg.WriteTimeout.String())
 	}
@@ -342,6 +608,14 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 					}
 				}
 				cfg.Net = dsn[j+1 : k]
+
+				// proxy(proxyaddr)/net(addr)
+				if isProxyNet(cfg.Net) {
+					cfg.ProxyNet = cfg.Net
+					if cfg.ProxyAddr, cfg.Net, cfg.Addr, err = splitProxyAddr(cfg.Addr); err != nil {
+						return nil, err
+					}
+				}
 			}
 
 			// dbname[?param1=value1&...&paramN=valueN]
@@ -443,7 +717,48 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 
 		// Compression
 		case "compress":
-			return errors.New("compression not implemented yet")
+			var isBool bool
+			cfg.Compress, isBool = readBool(value)
+			if !isBool {
+				return errors.New("invalid bool value: " + value)
+			}
+
+		case "compressionLevel":
+			cfg.CompressionLevel, err = strconv.Atoi(value)
+			if err != nil {
+				return
+			}
+
+		case "compressionThreshold":
+			cfg.CompressionThreshold, err = strconv.Atoi(value)
+			if err != nil {
+				return
+			}
+
+		// Connection attributes
+		case "connectionAttributes":
+			if cfg.ConnectionAttributes, err = url.QueryUnescape(value); err != nil {
+				return
+			}
+
+		// Fetch warnings with SHOW WARNINGS
+		case "fetchWarnings":
+			var isBool bool
+			cfg.FetchWarnings, isBool = readBool(value)
+			if !isBool {
+				return errors.New("invalid bool value: " + value)
+			}
+
+		// Backoff of failed hosts of multi-host addresses
+		case "hostBackoff":
+			cfg.HostBackoff, err = time.ParseDuration(value)
+			if err != nil {
+				return
+			}
+
+		// Policy for dialing multi-host addresses
+		case "hostPolicy":
+			cfg.HostPolicy = strings.ToLower(value)
 
 		// Enable client side placeholder substitution
 		case "interpolateParams":
@@ -453,6 +768,14 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				return errors.New("invalid bool value: " + value)
 			}
 
+		// Cancel running queries with KILL QUERY
+		case "killQueryOnCancel":
+			var isBool bool
+			cfg.KillQueryOnCancel, isBool = readBool(value)
+			if !isBool {
+				return errors.New("invalid bool value: " + value)
+			}
+
 		// Time Location
 		case "loc":
 			if value, err = url.QueryUnescape(value); err != nil {
@@ -479,6 +802,41 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				return errors.New("invalid bool value: " + value)
 			}
 
+		// Passwords of multi-factor authentication
+		case "password2", "password3":
+			passwd, err := url.QueryUnescape(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %v", param[0], err)
+			}
+			if param[0] == "password2" {
+				cfg.Passwd2 = passwd
+			} else {
+				cfg.Passwd3 = passwd
+			}
+
+		// PROXY protocol header
+		case "proxyProtocol":
+			cfg.ProxyProtocol = strings.ToLower(value)
+
+		// Credentials for the proxy of proxy(address)/net(addr)
+		case "proxyUser", "proxyPassword":
+			v, err := url.QueryUnescape(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %v", param[0], err)
+			}
+			if param[0] == "proxyUser" {
+				cfg.ProxyUser = v
+			} else {
+				cfg.ProxyPasswd = v
+			}
+
+		case "proxySourceAddr":
+			addr, err := url.QueryUnescape(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for proxy source address: %v", err)
+			}
+			cfg.ProxySourceAddr = addr
+
 		// I/O read Timeout
 		case "readTimeout":
 			cfg.ReadTimeout, err = time.ParseDuration(value)
@@ -494,6 +852,14 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				return errors.New("invalid bool value: " + value)
 			}
 
+		// Reset the session state when a connection is reused
+		case "resetSession":
+			var isBool bool
+			cfg.ResetSession, isBool = readBool(value)
+			if !isBool {
+				return errors.New("invalid bool value: " + value)
+			}
+
 		// Server public key
 		case "serverPubKey":
 			name, err := url.QueryUnescape(value)
@@ -502,6 +868,10 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 			}
 			cfg.ServerPubKey = name
 
+		// TLS mode like the ssl-mode option of the MySQL clients
+		case "ssl-mode":
+			cfg.SSLMode = strings.ToUpper(value)
+
 		// Strict mode
 		case "strict":
 			panic("strict mode has been removed. See https://github.com/go-sql-driver/mysql/wiki/strict-mode")
@@ -532,6 +902,31 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				cfg.TLSConfig = name
 			}
 
+		// TLS certificates and verification
+		case "tls-ca", "tls-cert", "tls-key", "tls-server-name":
+			v, err := url.QueryUnescape(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %v", param[0], err)
+			}
+			switch param[0] {
+			case "tls-ca":
+				cfg.TLSCA = v
+			case "tls-cert":
+				cfg.TLSCert = v
+			case "tls-key":
+				cfg.TLSKey = v
+			default:
+				cfg.TLSServerName = v
+			}
+
+		// Minimum TLS version
+		case "tls-min-version":
+			cfg.TLSMinVersion = value
+
+		// Return warnings of at least this severity as error
+		case "warningsAsErrors":
+			cfg.WarningsAsErrors = strings.ToLower(value)
+
 		// I/O write Timeout
 		case "writeTimeout":
 			cfg.WriteTimeout, err = time.ParseDuration(value)
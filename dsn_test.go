@@ -65,6 +65,36 @@ var testDSNs = []struct {
 }, {
 	"unix/?arg=%2Fsome%2Fpath.ext",
 	&Config{Net: "unix", Addr: "/tmp/mysql.sock", Params: map[string]string{"arg": "/some/path.ext"}, Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true},
+}, {
+	"tcp(127.0.0.1)/dbname?compress=true&compressionLevel=9&compressionThreshold=128",
+	&Config{Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, Compress: true, CompressionLevel: 9, CompressionThreshold: 128},
+}, {
+	"tcp(127.0.0.1)/dbname?resetSession=true",
+	&Config{Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, ResetSession: true},
+}, {
+	"user:p@ss@tcp(127.0.0.1)/dbname?password2=second%26factor&password3=third",
+	&Config{User: "user", Passwd: "p@ss", Passwd2: "second&factor", Passwd3: "third", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true},
+}, {
+	"tcp(127.0.0.1)/dbname?killQueryOnCancel=true",
+	&Config{Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, KillQueryOnCancel: true},
+}, {
+	"tcp(127.0.0.1)/dbname?fetchWarnings=true&warningsAsErrors=Warning",
+	&Config{Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, FetchWarnings: true, WarningsAsErrors: "warning"},
+}, {
+	"tcp(127.0.0.1)/dbname?connectionAttributes=program_name%3Aworker%2Ctenant%3Aacme",
+	&Config{Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, ConnectionAttributes: "program_name:worker,tenant:acme"},
+}, {
+	"tcp(example.com)/dbname?tls-server-name=db.internal&tls-min-version=TLS1.2",
+	&Config{Net: "tcp", Addr: "example.com:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, TLSServerName: "db.internal", TLSMinVersion: "TLS1.2"},
+}, {
+	"tcp(example.com)/dbname?ssl-mode=verify_ca",
+	&Config{Net: "tcp", Addr: "example.com:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, SSLMode: "VERIFY_CA"},
+}, {
+	"tcp(db1,db2:3307,[de:ad:be:ef::ca:fe]:80)/dbname?hostPolicy=Round-Robin&hostBackoff=5s",
+	&Config{Net: "tcp", Addr: "db1:3306,db2:3307,[de:ad:be:ef::ca:fe]:80", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, HostPolicy: "round-robin", HostBackoff: 5 * time.Second},
+}, {
+	"tcp(127.0.0.1)/dbname?proxyProtocol=V2&proxySourceAddr=%5B2001%3Adb8%3A%3A1%5D%3A4000",
+	&Config{Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, ProxyProtocol: "v2", ProxySourceAddr: "[2001:db8::1]:4000"},
 }, {
 	"tcp(127.0.0.1)/dbname",
 	&Config{Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: defaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true},
@@ -92,13 +122,26 @@ func TestDSNParser(t *testing.T) {
 
 func TestDSNParserInvalid(t *testing.T) {
 	var invalidDSNs = []string{
-		"@net(addr/",                  // no closing brace
-		"@tcp(/",                      // no closing brace
-		"tcp(/",                       // no closing brace
-		"(/",                          // no closing brace
-		"net(addr)//",                 // unescaped
-		"User:pass@tcp(1.2.3.4:3306)", // no trailing slash
-		"net()/",                      // unknown default addr
+		"@net(addr/",                                       // no closing brace
+		"@tcp(/",                                           // no closing brace
+		"tcp(/",                                            // no closing brace
+		"(/",                                               // no closing brace
+		"net(addr)//",                                      // unescaped
+		"User:pass@tcp(1.2.3.4:3306)",                      // no trailing slash
+		"net()/",                                           // unknown default addr
+		"/dbname?compressionLevel=10",                      // invalid compression level
+		"/dbname?warningsAsErrors=fatal",                   // invalid warning severity
+		"/dbname?connectionAttributes=tenant",              // connection attribute without value
+		"/dbname?tls-min-version=SSL3",                     // unknown TLS version
+		"/dbname?tls=false&tls-server-name=db",             // TLS parameters without TLS
+		"/dbname?tls-cert=client.pem",                      // certificate without key
+		"/dbname?tls-ca=%2Fdoes%2Fnot%2Fexist",             // missing CA file
+		"/dbname?proxyProtocol=v3",                         // unknown PROXY protocol version
+		"/dbname?proxySourceAddr=client",                   // source address without IP
+		"/dbname?hostPolicy=fastest",                       // unknown host policy
+		"/dbname?ssl-mode=optional",                        // unknown ssl-mode
+		"/dbname?ssl-mode=REQUIRED&tls=true",               // conflicting TLS settings
+		"/dbname?ssl-mode=DISABLED&tls-min-version=TLS1.2", // TLS parameters without TLS
 		//"/dbname?arg=/some/unescaped/path",
 	}
 
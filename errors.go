@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 // Various errors the driver might return. Can change between driver versions.
@@ -56,10 +57,133 @@ func SetLogger(logger Logger) error {
 
 // MySQLError is an error type which represents a single MySQL error
 type MySQLError struct {
-	Number  uint16
-	Message string
+	Number   uint16
+	Message  string
+	SQLState [5]byte // SQLSTATE value, zero if the server did not send one
 }
 
 func (me *MySQLError) Error() string {
+	if me.SQLState != [5]byte{} {
+		return fmt.Sprintf("Error %d (%s): %s", me.Number, me.SQLState, me.Message)
+	}
 	return fmt.Sprintf("Error %d: %s", me.Number, me.Message)
 }
+
+// MySQLWarnings is an error type which represents a group of one or more MySQL
+// warnings
+type MySQLWarnings []MySQLWarning
+
+func (mws MySQLWarnings) Error() string {
+	var msg string
+	for i, warning := range mws {
+		if i > 0 {
+			msg += "\r\n"
+		}
+		msg += fmt.Sprintf(
+			"%s %s: %s",
+			warning.Level,
+			warning.Code,
+			warning.Message,
+		)
+	}
+	return msg
+}
+
+// MySQLWarning is a single note, warning or error as returned by SHOW WARNINGS
+type MySQLWarning struct {
+	Level   string
+	Code    string
+	Message string
+}
+
+// warningSeverity maps the level of a warning to a comparable severity.
+// It returns 0 for unknown levels.
+func warningSeverity(level string) int {
+	switch strings.ToLower(level) {
+	case "note":
+		return 1
+	case "warning":
+		return 2
+	case "error":
+		return 3
+	}
+	return 0
+}
+
+// getWarnings reads the warnings of the last statement with SHOW WARNINGS.
+// The warning count, info and session state of the last statement are kept.
+// The statement already ran, so errors must never become driver.ErrBadConn,
+// which would make database/sql execute it again.
+func (mc *mysqlConn) getWarnings() (warnings MySQLWarnings, err error) {
+	count, info, session := mc.warnings, mc.info, mc.session
+	defer func() {
+		mc.warnings, mc.info, mc.session = count, info, session
+	}()
+
+	if err = mc.writeQueryPacket("SHOW WARNINGS"); err != nil {
+		if err == errBadConnNoWrite {
+			mc.cleanup()
+			err = ErrInvalidConn
+		}
+		return nil, err
+	}
+
+	resLen, err := mc.readResultSetHeaderPacket()
+	if err != nil || resLen == 0 {
+		return nil, err
+	}
+	if err = mc.skipColumns(resLen); err != nil {
+		return nil, err
+	}
+
+	warnings = make(MySQLWarnings, 0, count)
+	for {
+		data, err := mc.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		if data[0] == iERR {
+			return nil, mc.handleErrorPacket(data)
+		}
+		if mc.isEOFPacket(data) {
+			return warnings, mc.handleEOFPacket(data)
+		}
+
+		// Level, Code, Message [len coded string]
+		var warning MySQLWarning
+		var pos int
+		for _, v := range []*string{&warning.Level, &warning.Code, &warning.Message} {
+			val, _, n, err := readLengthEncodedString(data[pos:])
+			if err != nil {
+				return nil, err
+			}
+			*v = string(val)
+			pos += n
+		}
+		warnings = append(warnings, warning)
+	}
+}
+
+// fetchWarnings fetches the warnings of the last statement if configured.
+// The warnings are also returned as error if one of them reaches the severity
+// configured with WarningsAsErrors. Callers return their result along with
+// the error, since the statement itself succeeded.
+func (mc *mysqlConn) fetchWarnings() (MySQLWarnings, error) {
+	if mc.warnings == 0 || (!mc.cfg.FetchWarnings && mc.cfg.WarningsAsErrors == "") {
+		return nil, nil
+	}
+
+	warnings, err := mc.getWarnings()
+	if err != nil {
+		return nil, err
+	}
+
+	if severity := warningSeverity(mc.cfg.WarningsAsErrors); severity > 0 {
+		for _, warning := range warnings {
+			if warningSeverity(warning.Level) >= severity {
+				return warnings, warnings
+			}
+		}
+	}
+	return warnings, nil
+}
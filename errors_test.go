@@ -40,3 +40,31 @@ func TestErrorsStrictIgnoreNotes(t *testing.T) {
 		dbt.mustExec("DROP TABLE IF EXISTS does_not_exist")
 	})
 }
+
+func TestMySQLErrorSQLState(t *testing.T) {
+	_, mc := newRWMockConn(1)
+
+	// ER_DUP_ENTRY with SQLSTATE 23000
+	data := append([]byte{iERR, 0x26, 0x04, '#', '2', '3', '0', '0', '0'}, "Duplicate entry"...)
+	err := mc.handleErrorPacket(data)
+	me, ok := err.(*MySQLError)
+	if !ok {
+		t.Fatalf("expected *MySQLError, got %T", err)
+	}
+	if me.Number != 1062 || string(me.SQLState[:]) != "23000" || me.Message != "Duplicate entry" {
+		t.Errorf("unexpected error contents: %#v", me)
+	}
+	if expected := "Error 1062 (23000): Duplicate entry"; me.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, me.Error())
+	}
+
+	// error packet without SQLSTATE, e.g. during the handshake
+	data = append([]byte{iERR, 0x10, 0x04}, "Too many connections"...)
+	me = mc.handleErrorPacket(data).(*MySQLError)
+	if me.SQLState != [5]byte{} {
+		t.Errorf("unexpected SQLSTATE %q", me.SQLState)
+	}
+	if expected := "Error 1040: Too many connections"; me.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, me.Error())
+	}
+}
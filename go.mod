@@ -1,3 +1,5 @@
 module github.com/go-sql-driver/mysql
 
-go 1.10
+go 1.20
+
+require filippo.io/edwards25519 v1.1.0
@@ -0,0 +1,161 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policies for choosing the host of multi-host DSNs
+const (
+	hostPolicySequential          = "sequential"
+	hostPolicyRandom              = "random"
+	hostPolicyRoundRobin          = "round-robin"
+	hostPolicyLeastRecentlyFailed = "least-recently-failed"
+)
+
+const (
+	defaultHostBackoff = time.Second
+	maxHostBackoff     = time.Minute
+)
+
+func validHostPolicy(policy string) bool {
+	switch policy {
+	case "", hostPolicySequential, hostPolicyRandom, hostPolicyRoundRobin, hostPolicyLeastRecentlyFailed:
+		return true
+	}
+	return false
+}
+
+// splitAddrs splits the comma-separated addresses of multi-host DSNs
+func splitAddrs(addr string) []string {
+	return strings.Split(addr, ",")
+}
+
+// forHost returns a copy of the config for one host of a multi-host address.
+func (cfg *Config) forHost(addr string) *Config {
+	cp := cfg.Clone()
+	cp.Addr = addr
+	if cp.tls != nil && cp.tls.ServerName == "" && !cp.tls.InsecureSkipVerify {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			cp.tls.ServerName = host
+		}
+	}
+	return cp
+}
+
+type host struct {
+	addr        string
+	failures    int
+	lastFailure time.Time
+	retryAt     time.Time
+}
+
+// hostList tracks the state of the hosts of a multi-host DSN. Hosts which
+// failed are skipped until their backoff expires, which doubles with every
+// consecutive failure.
+type hostList struct {
+	policy  string
+	backoff time.Duration
+
+	mu    sync.Mutex
+	hosts []*host
+	next  int // start of the next round-robin
+}
+
+func newHostList(addrs []string, policy string, backoff time.Duration) *hostList {
+	if backoff <= 0 {
+		backoff = defaultHostBackoff
+	}
+	l := &hostList{policy: policy, backoff: backoff}
+	for _, addr := range addrs {
+		l.hosts = append(l.hosts, &host{addr: addr})
+	}
+	return l
+}
+
+// candidates returns the addresses in the order they should be dialed.
+// Hosts in backoff are moved to the end, so that they are still tried if all
+// hosts are down.
+func (l *hostList) candidates(now time.Time) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hosts := make([]*host, len(l.hosts))
+	copy(hosts, l.hosts)
+	switch l.policy {
+	case hostPolicyRandom:
+		rand.Shuffle(len(hosts), func(i, j int) {
+			hosts[i], hosts[j] = hosts[j], hosts[i]
+		})
+	case hostPolicyRoundRobin:
+		n := l.next % len(hosts)
+		hosts = append(hosts[n:], hosts[:n]...)
+		l.next++
+	case hostPolicyLeastRecentlyFailed:
+		sort.SliceStable(hosts, func(i, j int) bool {
+			return hosts[i].lastFailure.Before(hosts[j].lastFailure)
+		})
+	}
+
+	addrs := make([]string, 0, len(hosts))
+	var backoff []string
+	for _, h := range hosts {
+		if now.Before(h.retryAt) {
+			backoff = append(backoff, h.addr)
+		} else {
+			addrs = append(addrs, h.addr)
+		}
+	}
+	return append(addrs, backoff...)
+}
+
+func (l *hostList) get(addr string) *host {
+	for _, h := range l.hosts {
+		if h.addr == addr {
+			return h
+		}
+	}
+	return nil
+}
+
+// failed puts the host into backoff.
+func (l *hostList) failed(addr string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.get(addr)
+	if h == nil {
+		return
+	}
+	backoff := l.backoff << uint(h.failures)
+	if backoff <= 0 || backoff > maxHostBackoff {
+		backoff = maxHostBackoff
+	}
+	if backoff < l.backoff {
+		backoff = l.backoff
+	}
+	h.failures++
+	h.lastFailure = now
+	h.retryAt = now.Add(backoff)
+}
+
+// succeeded resets the backoff of the host.
+func (l *hostList) succeeded(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if h := l.get(addr); h != nil {
+		h.failures = 0
+		h.retryAt = time.Time{}
+	}
+}
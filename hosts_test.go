@@ -0,0 +1,151 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHostListPolicies(t *testing.T) {
+	addrs := []string{"a", "b", "c"}
+	now := time.Now()
+
+	l := newHostList(addrs, "", 0)
+	for i := 0; i < 2; i++ {
+		if c := l.candidates(now); !reflect.DeepEqual(c, addrs) {
+			t.Errorf("sequential: unexpected order %v", c)
+		}
+	}
+
+	l = newHostList(addrs, hostPolicyRoundRobin, 0)
+	for _, expected := range [][]string{{"a", "b", "c"}, {"b", "c", "a"}, {"c", "a", "b"}, {"a", "b", "c"}} {
+		if c := l.candidates(now); !reflect.DeepEqual(c, expected) {
+			t.Errorf("round-robin: expected %v, got %v", expected, c)
+		}
+	}
+
+	l = newHostList(addrs, hostPolicyRandom, 0)
+	c := l.candidates(now)
+	sort.Strings(c)
+	if !reflect.DeepEqual(c, addrs) {
+		t.Errorf("random: unexpected hosts %v", c)
+	}
+
+	l = newHostList(addrs, hostPolicyLeastRecentlyFailed, time.Nanosecond)
+	l.failed("a", now.Add(-2*time.Second))
+	l.failed("b", now.Add(-time.Second))
+	if c := l.candidates(now); !reflect.DeepEqual(c, []string{"c", "a", "b"}) {
+		t.Errorf("least-recently-failed: unexpected order %v", c)
+	}
+}
+
+func TestHostListBackoff(t *testing.T) {
+	now := time.Now()
+	l := newHostList([]string{"a", "b"}, "", time.Second)
+
+	l.failed("a", now)
+	if c := l.candidates(now); !reflect.DeepEqual(c, []string{"b", "a"}) {
+		t.Errorf("failed host was not skipped: %v", c)
+	}
+	if c := l.candidates(now.Add(time.Second)); !reflect.DeepEqual(c, []string{"a", "b"}) {
+		t.Errorf("failed host was not retried after the backoff: %v", c)
+	}
+
+	// the backoff doubles with consecutive failures
+	l.failed("a", now)
+	if c := l.candidates(now.Add(time.Second)); c[0] != "b" {
+		t.Errorf("expected a backoff of 2s: %v", c)
+	}
+	for i := 0; i < 100; i++ {
+		l.failed("a", now)
+	}
+	if c := l.candidates(now.Add(maxHostBackoff)); c[0] != "a" {
+		t.Errorf("expected a backoff of at most %v: %v", maxHostBackoff, c)
+	}
+
+	l.failed("a", now)
+	l.succeeded("a")
+	if c := l.candidates(now); c[0] != "a" {
+		t.Errorf("the backoff was not reset: %v", c)
+	}
+}
+
+func TestConnectorFailover(t *testing.T) {
+	var dialed []string
+	RegisterDialContext("failover", func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if addr == "primary" {
+			return nil, errors.New("connection refused")
+		}
+		return newHandshakeMockConn(), nil
+	})
+
+	cfg, err := ParseDSN("failover(primary,replica)/?hostPolicy=sequential&hostBackoff=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConnector(cfg)
+	for i := 0; i < 2; i++ {
+		conn, err := c.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr := conn.(*mysqlConn).cfg.Addr; addr != "replica" {
+			t.Errorf("expected a connection to replica, got %q", addr)
+		}
+		conn.Close()
+	}
+	// the failed primary is skipped by the second connection
+	if !reflect.DeepEqual(dialed, []string{"primary", "replica", "replica"}) {
+		t.Errorf("unexpected dials: %v", dialed)
+	}
+	if cfg.Addr != "primary,replica" {
+		t.Errorf("the config of the connector was modified: %q", cfg.Addr)
+	}
+}
+
+func TestConnectorFailoverHandshake(t *testing.T) {
+	var dialed []string
+	RegisterDialContext("failoverhandshake", func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if addr == "primary" {
+			// accept the connection, but close it before the handshake
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		return newHandshakeMockConn(), nil
+	})
+
+	cfg, err := ParseDSN("failoverhandshake(primary,replica)/?hostPolicy=sequential&hostBackoff=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConnector(cfg)
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if addr := conn.(*mysqlConn).cfg.Addr; addr != "replica" {
+		t.Errorf("expected a connection to replica, got %q", addr)
+	}
+	if !reflect.DeepEqual(dialed, []string{"primary", "replica"}) {
+		t.Errorf("unexpected dials: %v", dialed)
+	}
+	if hosts := c.hosts.candidates(time.Now()); hosts[0] != "replica" {
+		t.Errorf("primary was not put into backoff: %v", hosts)
+	}
+}
@@ -0,0 +1,86 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// InitConn is the new connection passed to Config.AfterConnect.
+//
+// The arguments of Exec and Query are interpolated into the query like with
+// the interpolateParams DSN parameter. The rows of Query must be closed
+// before the next statement is run. Cancellation of the context passed to
+// AfterConnect aborts the statements.
+type InitConn interface {
+	// Exec runs a statement which does not return rows.
+	Exec(query string, args ...interface{}) (driver.Result, error)
+
+	// Query runs a statement which returns rows.
+	Query(query string, args ...interface{}) (driver.Rows, error)
+
+	// ServerVersion returns the version the server sent in the handshake,
+	// e.g. "8.0.21" or "5.5.5-10.5.5-MariaDB".
+	ServerVersion() string
+}
+
+type initConn struct {
+	mc *mysqlConn
+}
+
+// interpolate interpolates the arguments into the query.
+func (ic initConn) interpolate(query string, args []interface{}) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	if n := strings.Count(query, "?"); n != len(args) {
+		return "", fmt.Errorf("mysql: %d arguments for %d placeholders", len(args), n)
+	}
+	dargs := make([]driver.Value, len(args))
+	for i, arg := range args {
+		v, err := (converter{}).ConvertValue(arg)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := v.(io.Reader); ok {
+			return "", fmt.Errorf("mysql: argument %d: an io.Reader cannot be interpolated", i+1)
+		}
+		dargs[i] = v
+	}
+	query, err := ic.mc.interpolateParams(query, dargs)
+	if err == driver.ErrSkip {
+		// the placeholders and the arguments are checked above, so the query
+		// exceeds max_allowed_packet
+		return "", ErrPktTooLarge
+	}
+	return query, err
+}
+
+func (ic initConn) Exec(query string, args ...interface{}) (driver.Result, error) {
+	query, err := ic.interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return ic.mc.Exec(query, nil)
+}
+
+func (ic initConn) Query(query string, args ...interface{}) (driver.Rows, error) {
+	query, err := ic.interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return ic.mc.Query(query, nil)
+}
+
+func (ic initConn) ServerVersion() string {
+	return ic.mc.serverVersion
+}
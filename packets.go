@@ -24,12 +24,20 @@ import (
 // Packets documentation:
 // http://dev.mysql.com/doc/internals/en/client-server-protocol.html
 
+// readNext returns the next n bytes of the (decompressed) packet stream
+func (mc *mysqlConn) readNext(need int) ([]byte, error) {
+	if mc.compIO != nil {
+		return mc.compIO.readNext(need)
+	}
+	return mc.buf.readNext(need)
+}
+
 // Read packet to buffer 'data'
 func (mc *mysqlConn) readPacket() ([]byte, error) {
 	var prevData []byte
 	for {
 		// read packet header
-		data, err := mc.buf.readNext(4)
+		data, err := mc.readNext(4)
 		if err != nil {
 			if cerr := mc.canceled.Value(); cerr != nil {
 				return nil, cerr
@@ -43,7 +51,11 @@ func (mc *mysqlConn) readPacket() ([]byte, error) {
 		pktLen := int(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
 
 		// check packet sync [8 bit]
-		if data[3] != mc.sequence {
+		if mc.compIO != nil {
+			// the compressed packet header already carries the sequence
+			// which is checked neither by libmysqlclient nor by the server
+			mc.sequence = data[3]
+		} else if data[3] != mc.sequence {
 			if data[3] > mc.sequence {
 				return nil, ErrPktSyncMul
 			}
@@ -65,7 +77,7 @@ func (mc *mysqlConn) readPacket() ([]byte, error) {
 		}
 
 		// read packet body [pktLen bytes]
-		data, err = mc.buf.readNext(pktLen)
+		data, err = mc.readNext(pktLen)
 		if err != nil {
 			if cerr := mc.canceled.Value(); cerr != nil {
 				return nil, cerr
@@ -153,7 +165,13 @@ func (mc *mysqlConn) writePacket(data []byte) error {
 		}
 
 		//写出包
-		n, err := mc.netConn.Write(data[:4+size])
+		var n int
+		var err error
+		if mc.compIO != nil {
+			n, err = mc.compIO.writePackets(data[:4+size])
+		} else {
+			n, err = mc.netConn.Write(data[:4+size])
+		}
 		if err == nil && n == 4+size {
 			mc.sequence++
 			if size != maxPacketSize {
@@ -218,6 +236,8 @@ func (mc *mysqlConn) readHandshakePacket() (data []byte, plugin string, err erro
 	// server version [null terminated string]
 	// connection id [4 bytes]
 	pos := 1 + bytes.IndexByte(data[1:], 0x00) + 1 + 4
+	mc.serverVersion = string(data[1 : pos-5])
+	mc.connectionID = binary.LittleEndian.Uint32(data[pos-4 : pos])
 
 	// first part of the password cipher [8 bytes]
 	authData := data[pos : pos+8]
@@ -231,7 +251,10 @@ func (mc *mysqlConn) readHandshakePacket() (data []byte, plugin string, err erro
 		return nil, "", ErrOldProtocol
 	}
 	if mc.flags&clientSSL == 0 && mc.cfg.tls != nil {
-		if mc.cfg.TLSConfig == "preferred" {
+		if mc.cfg.tlsPreferred() {
+			// fall back to plaintext without changing the config of the
+			// connector, which is shared by all connections
+			mc.cfg = mc.cfg.Clone()
 			mc.cfg.tls = nil
 		} else {
 			return nil, "", ErrNoTLS
@@ -243,6 +266,8 @@ func (mc *mysqlConn) readHandshakePacket() (data []byte, plugin string, err erro
 		// character set [1 byte]
 		// status flags [2 bytes]
 		// capability flags (upper 2 bytes) [2 bytes]
+		mc.flags |= clientFlag(binary.LittleEndian.Uint16(data[pos+3:pos+5])) << 16
+
 		// length of auth-plugin-data [1 byte]
 		// reserved (all [00]) [10 bytes]
 		pos += 1 + 2 + 2 + 1 + 10
@@ -293,7 +318,11 @@ func (mc *mysqlConn) writeHandshakeResponsePacket(authResp []byte, plugin string
 		clientLocalFiles |
 		clientPluginAuth |
 		clientMultiResults |
-		mc.flags&clientLongFlag
+		mc.flags&clientLongFlag |
+		mc.flags&clientDeprecateEOF |
+		mc.flags&clientSessionTrack |
+		mc.flags&clientQueryAttributes |
+		mc.flags&clientMultiFactorAuthentication
 
 	if mc.cfg.ClientFoundRows {
 		clientFlags |= clientFoundRows
@@ -308,6 +337,16 @@ func (mc *mysqlConn) writeHandshakeResponsePacket(authResp []byte, plugin string
 		clientFlags |= clientMultiStatements
 	}
 
+	// Let the server put sessions with expired passwords into sandbox mode
+	if mc.cfg.ChangeExpiredPassword != nil {
+		clientFlags |= mc.flags & clientCanHandleExpiredPasswords
+	}
+
+	// Compression is only enabled if the server supports it
+	if mc.cfg.Compress && mc.flags&clientCompress != 0 {
+		clientFlags |= clientCompress
+	}
+
 	// encode length of the auth plugin data
 	var authRespLEIBuf [9]byte
 	authRespLen := len(authResp)
@@ -318,7 +357,7 @@ func (mc *mysqlConn) writeHandshakeResponsePacket(authResp []byte, plugin string
 		clientFlags |= clientPluginAuthLenEncClientData
 	}
 
-	pktLen := 4 + 4 + 1 + 23 + len(mc.cfg.User) + 1 + len(authRespLEI) + len(authResp) + 21 + 1
+	pktLen := 4 + 4 + 1 + 23 + len(mc.cfg.User) + 1 + len(authRespLEI) + len(authResp) + len(plugin) + 1
 
 	// To specify a db name
 	if n := len(mc.cfg.DBName); n > 0 {
@@ -326,8 +365,19 @@ func (mc *mysqlConn) writeHandshakeResponsePacket(authResp []byte, plugin string
 		pktLen += n + 1
 	}
 
+	// Connection attributes, if the server supports them
+	var connAttrs []byte
+	if mc.flags&clientConnectAttrs != 0 {
+		clientFlags |= clientConnectAttrs
+		var err error
+		if connAttrs, err = mc.cfg.appendConnectionAttributes(nil); err != nil {
+			return err
+		}
+		pktLen += len(connAttrs)
+	}
+
 	// Calculate packet length and get buffer with that size
-	data, err := mc.buf.takeSmallBuffer(pktLen + 4)
+	data, err := mc.buf.takeBuffer(pktLen + 4)
 	if err != nil {
 		// cannot take the buffer. Something must be wrong with the connection
 		errLog.Print(err)
@@ -365,13 +415,18 @@ func (mc *mysqlConn) writeHandshakeResponsePacket(authResp []byte, plugin string
 	// SSL Connection Request Packet
 	// http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::SSLRequest
 	if mc.cfg.tls != nil {
+		tlsCfg, err := mc.cfg.tlsConfig()
+		if err != nil {
+			return err
+		}
+
 		// Send TLS / SSL request packet
 		if err := mc.writePacket(data[:(4+4+1+23)+4]); err != nil {
 			return err
 		}
 
 		// Switch to TLS
-		tlsConn := tls.Client(mc.netConn, mc.cfg.tls)
+		tlsConn := tls.Client(mc.netConn, tlsCfg)
 		if err := tlsConn.Handshake(); err != nil {
 			return err
 		}
@@ -402,14 +457,91 @@ func (mc *mysqlConn) writeHandshakeResponsePacket(authResp []byte, plugin string
 	data[pos] = 0x00
 	pos++
 
+	// Connection attributes [length encoded]
+	pos += copy(data[pos:], connAttrs)
+
+	// From here on mc.flags holds the negotiated capabilities
+	mc.flags = clientFlags
+
 	// Send Auth packet
 	return mc.writePacket(data[:pos])
 }
 
+// Change User Packet
+// http://dev.mysql.com/doc/internals/en/com-change-user.html
+func (mc *mysqlConn) writeChangeUserPacket(authResp []byte, plugin string) error {
+	// the length of the auth response is sent in 1 byte, COM_CHANGE_USER has
+	// no length encoded variant
+	if len(authResp) > 255 {
+		return errors.New("auth response too long for COM_CHANGE_USER")
+	}
+
+	collation, found := collations[mc.cfg.Collation]
+	if !found {
+		return errors.New("unknown collation")
+	}
+
+	pktLen := 1 + len(mc.cfg.User) + 1 + 1 + len(authResp) + len(mc.cfg.DBName) + 1 + 2 + len(plugin) + 1
+
+	var connAttrs []byte
+	if mc.flags&clientConnectAttrs != 0 {
+		var err error
+		if connAttrs, err = mc.cfg.appendConnectionAttributes(nil); err != nil {
+			return err
+		}
+		pktLen += len(connAttrs)
+	}
+
+	// Reset Packet Sequence
+	mc.resetSequence()
+
+	data, err := mc.buf.takeBuffer(pktLen + 4)
+	if err != nil {
+		// cannot take the buffer. Something must be wrong with the connection
+		errLog.Print(err)
+		return errBadConnNoWrite
+	}
+
+	// Add command byte
+	data[4] = comChangeUser
+	pos := 5
+
+	// User [null terminated string]
+	pos += copy(data[pos:], mc.cfg.User)
+	data[pos] = 0x00
+	pos++
+
+	// Auth Data [length byte + data]
+	data[pos] = byte(len(authResp))
+	pos++
+	pos += copy(data[pos:], authResp)
+
+	// Databasename [null terminated string]
+	pos += copy(data[pos:], mc.cfg.DBName)
+	data[pos] = 0x00
+	pos++
+
+	// Charset [2 bytes]
+	data[pos] = collation
+	data[pos+1] = 0x00
+	pos += 2
+
+	// Auth plugin name [null terminated string]
+	pos += copy(data[pos:], plugin)
+	data[pos] = 0x00
+	pos++
+
+	// Connection attributes [length encoded]
+	pos += copy(data[pos:], connAttrs)
+
+	// Send CMD packet
+	return mc.writePacket(data[:pos])
+}
+
 // http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::AuthSwitchResponse
 func (mc *mysqlConn) writeAuthSwitchPacket(authData []byte) error {
 	pktLen := 4 + len(authData)
-	data, err := mc.buf.takeSmallBuffer(pktLen)
+	data, err := mc.buf.takeBuffer(pktLen)
 	if err != nil {
 		// cannot take the buffer. Something must be wrong with the connection
 		errLog.Print(err)
@@ -425,9 +557,15 @@ func (mc *mysqlConn) writeAuthSwitchPacket(authData []byte) error {
 *                             Command Packets                                 *
 ******************************************************************************/
 
+// resetSequence resets the packet sequences at the start of a new command
+func (mc *mysqlConn) resetSequence() {
+	mc.sequence = 0
+	mc.compressSequence = 0
+}
+
 func (mc *mysqlConn) writeCommandPacket(command byte) error {
 	// Reset Packet Sequence
-	mc.sequence = 0
+	mc.resetSequence()
 
 	data, err := mc.buf.takeSmallBuffer(4 + 1)
 	if err != nil {
@@ -445,7 +583,7 @@ func (mc *mysqlConn) writeCommandPacket(command byte) error {
 
 func (mc *mysqlConn) writeCommandPacketStr(command byte, arg string) error {
 	// Reset Packet Sequence
-	mc.sequence = 0
+	mc.resetSequence()
 
 	//一位cmd + arg 也就是真实的查询语句
 	pktLen := 1 + len(arg)
@@ -469,9 +607,64 @@ func (mc *mysqlConn) writeCommandPacketStr(command byte, arg string) error {
 	return mc.writePacket(data)
 }
 
+// Send a COM_QUERY, with the query attributes if CLIENT_QUERY_ATTRIBUTES was
+// negotiated. The query attributes are consumed.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_query.html
+func (mc *mysqlConn) writeQueryPacket(query string) error {
+	if mc.flags&clientQueryAttributes == 0 {
+		return mc.writeCommandPacketStr(comQuery, query)
+	}
+
+	attrs := mc.queryAttrs
+	mc.queryAttrs = nil
+	names := sortedAttributeNames(attrs)
+
+	// parameter_count [lenenc], parameter_set_count [lenenc] (always 1)
+	params := appendLengthEncodedInteger(nil, uint64(len(names)))
+	params = append(params, 0x01)
+	if len(names) > 0 {
+		// NULL-bitmap [(parameter_count + 7) / 8 bytes], no NULL values
+		params = append(params, make([]byte, (len(names)+7)/8)...)
+
+		// new_params_bind_flag [1 byte]
+		params = append(params, 0x01)
+
+		// type [2 bytes] and name [lenenc] of each parameter
+		for _, name := range names {
+			params = append(params, byte(fieldTypeString), 0x00)
+			params = appendLengthEncodedString(params, name)
+		}
+
+		// value of each parameter
+		for _, name := range names {
+			params = appendLengthEncodedString(params, attrs[name])
+		}
+	}
+
+	// Reset Packet Sequence
+	mc.resetSequence()
+
+	pktLen := 1 + len(params) + len(query)
+	data, err := mc.buf.takeBuffer(pktLen + 4)
+	if err != nil {
+		// cannot take the buffer. Something must be wrong with the connection
+		errLog.Print(err)
+		return errBadConnNoWrite
+	}
+
+	// Add command byte
+	data[4] = comQuery
+
+	// Add query attributes and query
+	copy(data[5+copy(data[5:], params):], query)
+
+	// Send CMD packet
+	return mc.writePacket(data)
+}
+
 func (mc *mysqlConn) writeCommandPacketUint32(command byte, arg uint32) error {
 	// Reset Packet Sequence
-	mc.sequence = 0
+	mc.resetSequence()
 
 	data, err := mc.buf.takeSmallBuffer(4 + 1 + 4)
 	if err != nil {
@@ -497,36 +690,40 @@ func (mc *mysqlConn) writeCommandPacketUint32(command byte, arg uint32) error {
 *                              Result Packets                                 *
 ******************************************************************************/
 
-func (mc *mysqlConn) readAuthResult() ([]byte, string, error) {
+// readAuthResult reads the response of the server to an auth packet. It
+// returns the plugin and its auth data for auth switch requests and
+// AuthNextFactor packets (with nextFactor set), the data of AuthMoreData
+// packets, or nil data if the authentication succeeded.
+func (mc *mysqlConn) readAuthResult() (authData []byte, plugin string, nextFactor bool, err error) {
 	data, err := mc.readPacket()
 	if err != nil {
-		return nil, "", err
+		return nil, "", false, err
 	}
 
 	// packet indicator
 	switch data[0] {
 
 	case iOK:
-		return nil, "", mc.handleOkPacket(data)
+		return nil, "", false, mc.handleOkPacket(data)
 
 	case iAuthMoreData:
-		return data[1:], "", err
+		return data[1:], "", false, err
 
-	case iEOF:
-		if len(data) == 1 {
+	case iAuthNextFactor, iEOF:
+		if data[0] == iEOF && len(data) == 1 {
 			// https://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::OldAuthSwitchRequest
-			return nil, "mysql_old_password", nil
+			return nil, "mysql_old_password", false, nil
 		}
 		pluginEndIndex := bytes.IndexByte(data, 0x00)
 		if pluginEndIndex < 0 {
-			return nil, "", ErrMalformPkt
+			return nil, "", false, ErrMalformPkt
 		}
-		plugin := string(data[1:pluginEndIndex])
-		authData := data[pluginEndIndex+1:]
-		return authData, plugin, nil
+		plugin = string(data[1:pluginEndIndex])
+		authData = data[pluginEndIndex+1:]
+		return authData, plugin, data[0] == iAuthNextFactor, nil
 
 	default: // Error otherwise
-		return nil, "", mc.handleErrorPacket(data)
+		return nil, "", false, mc.handleErrorPacket(data)
 	}
 }
 
@@ -604,19 +801,27 @@ func (mc *mysqlConn) handleErrorPacket(data []byte) error {
 		return driver.ErrBadConn
 	}
 
+	// 1317: ER_QUERY_INTERRUPTED, the statement was killed by KILL QUERY
+	// after the context was canceled
+	if errno == 1317 && mc.cfg.KillQueryOnCancel && mc.watchCtx != nil {
+		if err := mc.watchCtx.Err(); err != nil {
+			return err
+		}
+	}
+
+	me := &MySQLError{Number: errno}
+
 	pos := 3
 
 	// SQL State [optional: # + 5bytes string]
-	if data[3] == 0x23 {
-		//sqlstate := string(data[4 : 4+5])
+	if len(data) >= 9 && data[3] == 0x23 {
+		copy(me.SQLState[:], data[4:4+5])
 		pos = 9
 	}
 
 	// Error Message [string]
-	return &MySQLError{
-		Number:  errno,
-		Message: string(data[pos:]),
-	}
+	me.Message = string(data[pos:])
+	return me
 }
 
 func readStatus(b []byte) statusFlag {
@@ -636,14 +841,84 @@ func (mc *mysqlConn) handleOkPacket(data []byte) error {
 	// Insert id [Length Coded Binary]
 	mc.insertId, _, m = readLengthEncodedInteger(data[1+n:])
 
+	return mc.handleOkTrailer(data[1+n+m:])
+}
+
+// handleOkTrailer reads the part of an OK packet following the insert id
+func (mc *mysqlConn) handleOkTrailer(data []byte) error {
 	// server_status [2 bytes]
-	mc.status = readStatus(data[1+n+m : 1+n+m+2])
-	if mc.status&statusMoreResultsExists != 0 {
+	mc.status = readStatus(data[0:2])
+
+	// warning count [2 bytes]
+	mc.warnings = 0
+	if len(data) >= 4 {
+		mc.warnings = binary.LittleEndian.Uint16(data[2:4])
+	}
+
+	mc.info = ""
+	mc.session = SessionState{}
+	if len(data) <= 4 {
 		return nil
 	}
+	data = data[4:]
 
-	// warning count [2 bytes]
+	if mc.flags&clientSessionTrack == 0 {
+		// info [string<EOF>]
+		mc.info = string(data)
+		return nil
+	}
+
+	// info [length encoded string]
+	info, _, n, err := readLengthEncodedString(data)
+	if err != nil {
+		return ErrMalformPkt
+	}
+	mc.info = string(info)
+
+	// session state info [length encoded string]
+	if mc.status&statusSessionStateChanged != 0 {
+		changes, _, _, err := readLengthEncodedString(data[n:])
+		if err != nil {
+			return ErrMalformPkt
+		}
+		return mc.session.parse(changes)
+	}
+	return nil
+}
+
+// isEOFPacket reports whether data is the packet terminating a result set or
+// a block of column definitions: an EOF packet or, if CLIENT_DEPRECATE_EOF was
+// negotiated, an OK packet with an 0xfe header.
+// Row data packets may start with 0xfe as well if the first value is longer
+// than 2^24-1 bytes, but then the packet is larger than any EOF / OK packet.
+func (mc *mysqlConn) isEOFPacket(data []byte) bool {
+	if data[0] != iEOF {
+		return false
+	}
+	if mc.flags&clientDeprecateEOF != 0 {
+		return len(data) < maxPacketSize
+	}
+	return len(data) < 9
+}
+
+// EOF Packet
+// http://dev.mysql.com/doc/internals/en/packet-EOF_Packet.html
+func (mc *mysqlConn) handleEOFPacket(data []byte) error {
+	if mc.flags&clientDeprecateEOF != 0 {
+		// 0xfe [1 byte]
+		// affected rows and insert id [Length Coded Binary], both always 0
+		_, _, n := readLengthEncodedInteger(data[1:])
+		_, _, m := readLengthEncodedInteger(data[1+n:])
+		return mc.handleOkTrailer(data[1+n+m:])
+	}
 
+	if len(data) == 5 {
+		// warning count [2 bytes]
+		mc.warnings = binary.LittleEndian.Uint16(data[1:3])
+		// server_status [2 bytes]
+		mc.status = readStatus(data[3:])
+		mc.info = ""
+	}
 	return nil
 }
 
@@ -655,14 +930,23 @@ func (mc *mysqlConn) readColumns(count int) ([]mysqlField, error) {
 
 	// 死循环
 	for i := 0; ; i++ {
+		// no EOF Packet follows the columns with CLIENT_DEPRECATE_EOF
+		if i == count && mc.flags&clientDeprecateEOF != 0 {
+			return columns, nil
+		}
+
 		data, err := mc.readPacket()
 		if err != nil {
 			return nil, err
 		}
 
 		// EOF Packet
-		if data[0] == iEOF && (len(data) == 5 || len(data) == 1) {
+		if mc.isEOFPacket(data) {
 			if i == count {
+				if len(data) == 5 {
+					// server_status [2 bytes]
+					mc.status = readStatus(data[3:])
+				}
 				return columns, nil
 			}
 			return nil, fmt.Errorf("column count mismatch n:%d len:%d", count, len(columns))
@@ -764,14 +1048,8 @@ func (rows *textRows) readRow(dest []driver.Value) error {
 	}
 
 	// EOF Packet
-	if data[0] == iEOF && len(data) == 5 {
-		// server_status [2 bytes]
-		rows.mc.status = readStatus(data[3:])
-		rows.rs.done = true
-		if !rows.HasNextResultSet() {
-			rows.mc = nil
-		}
-		return io.EOF
+	if mc.isEOFPacket(data) {
+		return rows.handleEOF(data)
 	}
 	if data[0] == iERR {
 		rows.mc = nil
@@ -830,14 +1108,28 @@ func (mc *mysqlConn) readUntilEOF() error {
 		case iERR:
 			return mc.handleErrorPacket(data)
 		case iEOF:
-			if len(data) == 5 {
-				mc.status = readStatus(data[3:])
+			if mc.isEOFPacket(data) {
+				return mc.handleEOFPacket(data)
 			}
-			return nil
 		}
 	}
 }
 
+// Reads count column definition packets and the EOF packet following them,
+// which is omitted if CLIENT_DEPRECATE_EOF was negotiated.
+func (mc *mysqlConn) skipColumns(count int) error {
+	if mc.flags&clientDeprecateEOF == 0 {
+		return mc.readUntilEOF()
+	}
+
+	for i := 0; i < count; i++ {
+		if _, err := mc.readPacket(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 /******************************************************************************
 *                           Prepared Statements                               *
 ******************************************************************************/
@@ -894,7 +1186,7 @@ func (stmt *mysqlStmt) writeCommandLongData(paramID int, arg []byte) error {
 			pktLen = dataOffset + argLen
 		}
 
-		stmt.mc.sequence = 0
+		stmt.mc.resetSequence()
 		// Add command byte [1 byte]
 		data[4] = comStmtSendLongData
 
@@ -919,13 +1211,83 @@ func (stmt *mysqlStmt) writeCommandLongData(paramID int, arg []byte) error {
 	}
 
 	// Reset Packet Sequence
-	stmt.mc.sequence = 0
+	stmt.mc.resetSequence()
 	return nil
 }
 
+// writeCommandLongDataReader streams the parameter value read from r in chunks.
+// If reading from r fails, the data sent so far is discarded with
+// COM_STMT_RESET and the read error is returned.
+func (stmt *mysqlStmt) writeCommandLongDataReader(paramID int, r io.Reader) error {
+	mc := stmt.mc
+	const dataOffset = 1 + 4 + 2
+
+	// 16KB is small enough to not allocate much for every argument and large
+	// enough for TCP, like the packets of LOAD DATA LOCAL INFILE
+	pktLen := 16 * 1024
+	if mc.maxAllowedPacket-1 < pktLen {
+		pktLen = mc.maxAllowedPacket - 1
+	}
+
+	// Cannot use the write buffer since it is in use
+	data := make([]byte, 4+pktLen)
+
+	// Add command byte [1 byte]
+	data[4] = comStmtSendLongData
+
+	// Add stmtID [32 bit]
+	data[5] = byte(stmt.id)
+	data[6] = byte(stmt.id >> 8)
+	data[7] = byte(stmt.id >> 16)
+	data[8] = byte(stmt.id >> 24)
+
+	// Add paramID [16 bit]
+	data[9] = byte(paramID)
+	data[10] = byte(paramID >> 8)
+
+	// Send at least one packet, an empty value must not be mistaken for a
+	// value in the execute packet
+	for sent := false; ; sent = true {
+		n, err := io.ReadFull(r, data[4+dataOffset:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+			if n == 0 && sent {
+				break
+			}
+		} else if err != nil {
+			return stmt.reset(err)
+		}
+
+		mc.resetSequence()
+		if err := mc.writePacket(data[:4+dataOffset+n]); err != nil {
+			return err
+		}
+		if 4+dataOffset+n < len(data) {
+			break
+		}
+	}
+
+	// Reset Packet Sequence
+	mc.resetSequence()
+	return nil
+}
+
+// reset discards the long data sent for the statement with COM_STMT_RESET
+// and returns err.
+func (stmt *mysqlStmt) reset(err error) error {
+	mc := stmt.mc
+	if werr := mc.writeCommandPacketUint32(comStmtReset, stmt.id); werr != nil {
+		return werr
+	}
+	if rerr := mc.readResultOK(); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
 // Execute Prepared Statement 执行预处理语句
 // http://dev.mysql.com/doc/internals/en/com-stmt-execute.html
-func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
+func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value, cursorType byte) error {
 	if len(args) != stmt.paramCount {
 		return fmt.Errorf(
 			"argument count mismatch (got: %d; has: %d)",
@@ -937,6 +1299,16 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 	const minPktLen = 4 + 1 + 4 + 1 + 4
 	mc := stmt.mc
 
+	// Query attributes are sent as additional named parameters
+	queryAttrs := mc.flags&clientQueryAttributes != 0
+	attrs := mc.queryAttrs
+	mc.queryAttrs = nil
+	var attrNames []string
+	if queryAttrs {
+		attrNames = sortedAttributeNames(attrs)
+	}
+	numParams := len(args) + len(attrNames)
+
 	// Determine threshold dynamically to avoid packet size shortage.
 	longDataSize := mc.maxAllowedPacket / (stmt.paramCount + 1)
 	if longDataSize < 64 {
@@ -944,12 +1316,12 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 	}
 
 	// Reset packet-sequence
-	mc.sequence = 0
+	mc.resetSequence()
 
 	var data []byte
 	var err error
 
-	if len(args) == 0 {
+	if numParams == 0 {
 		data, err = mc.buf.takeBuffer(minPktLen)
 	} else {
 		data, err = mc.buf.takeCompleteBuffer()
@@ -970,8 +1342,11 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 	data[7] = byte(stmt.id >> 16)
 	data[8] = byte(stmt.id >> 24)
 
-	// flags (0: CURSOR_TYPE_NO_CURSOR) [1 byte]
-	data[9] = 0x00
+	// flags (cursor type) [1 byte]
+	data[9] = cursorType
+	if len(attrNames) > 0 {
+		data[9] |= parameterCountAvailable
+	}
 
 	// iteration_count (uint32(1)) [4 bytes]
 	data[10] = 0x01
@@ -979,11 +1354,26 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 	data[12] = 0x00
 	data[13] = 0x00
 
-	if len(args) > 0 {
+	if numParams > 0 {
 		pos := minPktLen
 
+		// type [2 bytes] of each parameter
+		typeSize := 2
+		typesLen := 1 + 2*len(args)
+		if queryAttrs {
+			// parameter_count [lenenc]
+			pos = len(appendLengthEncodedInteger(data[:pos], uint64(numParams)))
+
+			// each type is followed by the name [lenenc], empty for arguments
+			typeSize = 3
+			typesLen = 1 + 3*len(args)
+			for _, name := range attrNames {
+				typesLen += 2 + len(appendLengthEncodedInteger(nil, uint64(len(name)))) + len(name)
+			}
+		}
+
 		var nullMask []byte
-		if maskLen, typesLen := (len(args)+7)/8, 1+2*len(args); pos+maskLen+typesLen >= cap(data) {
+		if maskLen := (numParams + 7) / 8; pos+maskLen+typesLen >= cap(data) {
 			// buffer has to be extended but we don't know by how much so
 			// we depend on append after all data with known sizes fit.
 			// We stop at that because we deal with a lot of columns here
@@ -1006,20 +1396,32 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 		data[pos] = 0x01
 		pos++
 
-		// type of each parameter [len(args)*2 bytes]
+		// type of each parameter [len(args)*typeSize bytes]
 		paramTypes := data[pos:]
-		pos += len(args) * 2
+		pos += typesLen - 1
+
+		// types and names of the query attributes
+		attrTypes := paramTypes[len(args)*typeSize : len(args)*typeSize]
+		for _, name := range attrNames {
+			attrTypes = append(attrTypes, byte(fieldTypeString), 0x00)
+			attrTypes = appendLengthEncodedString(attrTypes, name)
+		}
 
 		// value of each parameter [n bytes]
 		paramValues := data[pos:pos]
 		valuesCap := cap(paramValues)
 
 		for i, arg := range args {
+			if typeSize == 3 {
+				// empty name [1 byte]
+				paramTypes[i*typeSize+2] = 0x00
+			}
+
 			// build NULL-bitmap
 			if arg == nil {
 				nullMask[i/8] |= 1 << (uint(i) & 7)
-				paramTypes[i+i] = byte(fieldTypeNULL)
-				paramTypes[i+i+1] = 0x00
+				paramTypes[i*typeSize] = byte(fieldTypeNULL)
+				paramTypes[i*typeSize+1] = 0x00
 				continue
 			}
 
@@ -1029,8 +1431,8 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 			// cache types and values
 			switch v := arg.(type) {
 			case int64:
-				paramTypes[i+i] = byte(fieldTypeLongLong)
-				paramTypes[i+i+1] = 0x00
+				paramTypes[i*typeSize] = byte(fieldTypeLongLong)
+				paramTypes[i*typeSize+1] = 0x00
 
 				if cap(paramValues)-len(paramValues)-8 >= 0 {
 					paramValues = paramValues[:len(paramValues)+8]
@@ -1045,8 +1447,8 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 				}
 
 			case uint64:
-				paramTypes[i+i] = byte(fieldTypeLongLong)
-				paramTypes[i+i+1] = 0x80 // type is unsigned
+				paramTypes[i*typeSize] = byte(fieldTypeLongLong)
+				paramTypes[i*typeSize+1] = 0x80 // type is unsigned
 
 				if cap(paramValues)-len(paramValues)-8 >= 0 {
 					paramValues = paramValues[:len(paramValues)+8]
@@ -1061,8 +1463,8 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 				}
 
 			case float64:
-				paramTypes[i+i] = byte(fieldTypeDouble)
-				paramTypes[i+i+1] = 0x00
+				paramTypes[i*typeSize] = byte(fieldTypeDouble)
+				paramTypes[i*typeSize+1] = 0x00
 
 				if cap(paramValues)-len(paramValues)-8 >= 0 {
 					paramValues = paramValues[:len(paramValues)+8]
@@ -1077,8 +1479,8 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 				}
 
 			case bool:
-				paramTypes[i+i] = byte(fieldTypeTiny)
-				paramTypes[i+i+1] = 0x00
+				paramTypes[i*typeSize] = byte(fieldTypeTiny)
+				paramTypes[i*typeSize+1] = 0x00
 
 				if v {
 					paramValues = append(paramValues, 0x01)
@@ -1089,8 +1491,8 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 			case []byte:
 				// Common case (non-nil value) first
 				if v != nil {
-					paramTypes[i+i] = byte(fieldTypeString)
-					paramTypes[i+i+1] = 0x00
+					paramTypes[i*typeSize] = byte(fieldTypeString)
+					paramTypes[i*typeSize+1] = 0x00
 
 					if len(v) < longDataSize {
 						paramValues = appendLengthEncodedInteger(paramValues,
@@ -1107,12 +1509,12 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 
 				// Handle []byte(nil) as a NULL value
 				nullMask[i/8] |= 1 << (uint(i) & 7)
-				paramTypes[i+i] = byte(fieldTypeNULL)
-				paramTypes[i+i+1] = 0x00
+				paramTypes[i*typeSize] = byte(fieldTypeNULL)
+				paramTypes[i*typeSize+1] = 0x00
 
 			case string:
-				paramTypes[i+i] = byte(fieldTypeString)
-				paramTypes[i+i+1] = 0x00
+				paramTypes[i*typeSize] = byte(fieldTypeString)
+				paramTypes[i*typeSize+1] = 0x00
 
 				if len(v) < longDataSize {
 					paramValues = appendLengthEncodedInteger(paramValues,
@@ -1125,9 +1527,17 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 					}
 				}
 
+			case io.Reader:
+				paramTypes[i*typeSize] = byte(fieldTypeString)
+				paramTypes[i*typeSize+1] = 0x00
+
+				if err := stmt.writeCommandLongDataReader(i, v); err != nil {
+					return err
+				}
+
 			case time.Time:
-				paramTypes[i+i] = byte(fieldTypeString)
-				paramTypes[i+i+1] = 0x00
+				paramTypes[i*typeSize] = byte(fieldTypeString)
+				paramTypes[i*typeSize+1] = 0x00
 
 				var a [64]byte
 				var b = a[:0]
@@ -1148,6 +1558,11 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 			}
 		}
 
+		// value of each query attribute
+		for _, name := range attrNames {
+			paramValues = appendLengthEncodedString(paramValues, attrs[name])
+		}
+
 		// Check if param values exceeded the available buffer
 		// In that case we must build the data packet with the new values buffer
 		if valuesCap != cap(paramValues) {
@@ -1165,6 +1580,39 @@ func (stmt *mysqlStmt) writeExecutePacket(args []driver.Value) error {
 	return mc.writePacket(data)
 }
 
+// Fetch rows from a cursor
+// http://dev.mysql.com/doc/internals/en/com-stmt-fetch.html
+func (stmt *mysqlStmt) writeFetchPacket(numRows int) error {
+	mc := stmt.mc
+
+	// Reset packet-sequence
+	mc.resetSequence()
+
+	data, err := mc.buf.takeSmallBuffer(4 + 1 + 4 + 4)
+	if err != nil {
+		// cannot take the buffer. Something must be wrong with the connection
+		errLog.Print(err)
+		return errBadConnNoWrite
+	}
+
+	// command [1 byte]
+	data[4] = comStmtFetch
+
+	// statement_id [4 bytes]
+	data[5] = byte(stmt.id)
+	data[6] = byte(stmt.id >> 8)
+	data[7] = byte(stmt.id >> 16)
+	data[8] = byte(stmt.id >> 24)
+
+	// num rows [4 bytes]
+	data[9] = byte(numRows)
+	data[10] = byte(numRows >> 8)
+	data[11] = byte(numRows >> 16)
+	data[12] = byte(numRows >> 24)
+
+	return mc.writePacket(data)
+}
+
 func (mc *mysqlConn) discardResults() error {
 	for mc.status&statusMoreResultsExists != 0 {
 		resLen, err := mc.readResultSetHeaderPacket()
@@ -1173,7 +1621,7 @@ func (mc *mysqlConn) discardResults() error {
 		}
 		if resLen > 0 {
 			// columns
-			if err := mc.readUntilEOF(); err != nil {
+			if err := mc.skipColumns(resLen); err != nil {
 				return err
 			}
 			// rows
@@ -1195,13 +1643,8 @@ func (rows *binaryRows) readRow(dest []driver.Value) error {
 	// packet indicator [1 byte]
 	if data[0] != iOK {
 		// EOF Packet
-		if data[0] == iEOF && len(data) == 5 {
-			rows.mc.status = readStatus(data[3:])
-			rows.rs.done = true
-			if !rows.HasNextResultSet() {
-				rows.mc = nil
-			}
-			return io.EOF
+		if rows.mc.isEOFPacket(data) {
+			return rows.handleEOF(data)
 		}
 		mc := rows.mc
 		rows.mc = nil
@@ -1210,6 +1653,13 @@ func (rows *binaryRows) readRow(dest []driver.Value) error {
 		return mc.handleErrorPacket(data)
 	}
 
+	return rows.decodeRow(data, dest)
+}
+
+// decodeRow decodes the binary row data into dest
+func (rows *binaryRows) decodeRow(data []byte, dest []driver.Value) error {
+	var err error
+
 	// NULL-bitmap,  [(column-count + 7 + 2) / 8 bytes]
 	pos := 1 + (len(dest)+7+2)>>3
 	nullMask := data[1:pos]
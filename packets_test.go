@@ -10,7 +10,10 @@ package mysql
 
 import (
 	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
 	"errors"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -334,3 +337,122 @@ func TestRegression801(t *testing.T) {
 		t.Errorf("expected authData '%v', got '%v'", expectedAuthData, authData)
 	}
 }
+
+// appendTestPacket appends payload framed as a packet with the given sequence
+func appendTestPacket(buf []byte, seq uint8, payload []byte) []byte {
+	n := len(payload)
+	buf = append(buf, byte(n), byte(n>>8), byte(n>>16), seq)
+	return append(buf, payload...)
+}
+
+// testColumnDefinition returns a Protocol::ColumnDefinition41 payload
+func testColumnDefinition(name string, typ fieldType) []byte {
+	b := []byte{3, 'd', 'e', 'f', 0, 0, 0}
+	b = append(b, byte(len(name)))
+	b = append(b, name...)
+	b = append(b, 0, 0x0c, 0x21, 0, 0xff, 0, 0, 0, byte(typ), 0, 0, 0, 0, 0)
+	return b
+}
+
+func TestReadResultSetDeprecateEOF(t *testing.T) {
+	conn, mc := newRWMockConn(1)
+	mc.flags = clientDeprecateEOF
+
+	// 2 column definitions without EOF packet, one row and an OK packet with
+	// 0xfe header, status SERVER_STATUS_AUTOCOMMIT, 1 warning and info
+	var data []byte
+	data = appendTestPacket(data, 1, testColumnDefinition("a", fieldTypeVarString))
+	data = appendTestPacket(data, 2, testColumnDefinition("b", fieldTypeVarString))
+	data = appendTestPacket(data, 3, []byte{1, 'x', 0xfb})
+	data = appendTestPacket(data, 4, []byte{0xfe, 0, 0, 0x02, 0, 1, 0, 'i', 'n', 'f', 'o'})
+	conn.data = data
+	conn.maxReads = 1
+
+	columns, err := mc.readColumns(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 2 || columns[0].name != "a" || columns[1].name != "b" {
+		t.Fatalf("unexpected columns: %+v", columns)
+	}
+
+	rows := &textRows{mysqlRows{mc: mc}}
+	rows.rs.columns = columns
+	dest := make([]driver.Value, 2)
+	if err = rows.readRow(dest); err != nil {
+		t.Fatal(err)
+	}
+	if string(dest[0].([]byte)) != "x" || dest[1] != nil {
+		t.Fatalf("unexpected row: %v", dest)
+	}
+
+	if err = rows.readRow(dest); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if mc.status != statusInAutocommit {
+		t.Errorf("unexpected status: %d", mc.status)
+	}
+	if rows.rs.warnings != 1 || rows.rs.info != "info" {
+		t.Errorf("unexpected trailer: warnings %d, info %q", rows.rs.warnings, rows.rs.info)
+	}
+}
+
+func TestHandshakeResponseDeprecateEOF(t *testing.T) {
+	conn, mc := newRWMockConn(1)
+	mc.flags = clientProtocol41 | clientDeprecateEOF
+
+	if err := mc.writeHandshakeResponsePacket(nil, defaultAuthPlugin); err != nil {
+		t.Fatal(err)
+	}
+	flags := clientFlag(binary.LittleEndian.Uint32(conn.written[4:8]))
+	if flags&clientDeprecateEOF == 0 {
+		t.Error("CLIENT_DEPRECATE_EOF was not negotiated")
+	}
+	if mc.flags != flags {
+		t.Errorf("negotiated flags not stored: %x != %x", mc.flags, flags)
+	}
+}
+
+func TestHandshakeResponseConnectionAttributes(t *testing.T) {
+	conn, mc := newRWMockConn(1)
+	mc.flags = clientProtocol41 | clientConnectAttrs
+	mc.cfg.User = "root"
+	mc.cfg.ConnectionAttributes = "program_name:worker,tenant:acme"
+
+	if err := mc.writeHandshakeResponsePacket(nil, defaultAuthPlugin); err != nil {
+		t.Fatal(err)
+	}
+	flags := clientFlag(binary.LittleEndian.Uint32(conn.written[4:8]))
+	if flags&clientConnectAttrs == 0 {
+		t.Fatal("CLIENT_CONNECT_ATTRS was not requested")
+	}
+
+	// user, auth response and plugin name precede the attributes
+	pos := 4 + 4 + 4 + 1 + 23 + len("root") + 1 + 1 + len(defaultAuthPlugin) + 1
+	attrsLen, _, n := readLengthEncodedInteger(conn.written[pos:])
+	data := conn.written[pos+n:]
+	if int(attrsLen) != len(data) {
+		t.Fatalf("wrong length of connection attributes: %d, have %d bytes", attrsLen, len(data))
+	}
+
+	attrs := make(map[string]string)
+	for len(data) > 0 {
+		key, _, n, err := readLengthEncodedString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _, m, err := readLengthEncodedString(data[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs[string(key)] = string(value)
+		data = data[n+m:]
+	}
+
+	if attrs["program_name"] != "worker" || attrs["tenant"] != "acme" {
+		t.Errorf("user attributes missing: %v", attrs)
+	}
+	if attrs["_client_name"] != driverName || attrs["_pid"] == "" || attrs["_os"] == "" {
+		t.Errorf("default attributes missing: %v", attrs)
+	}
+}
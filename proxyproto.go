@@ -0,0 +1,125 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Versions of the PROXY protocol
+// https://www.haproxy.org/download/2.2/doc/proxy-protocol.txt
+const (
+	proxyProtocolV1 = "v1"
+	proxyProtocolV2 = "v2"
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// parseProxySourceAddr parses the ip[:port] of the proxySourceAddr DSN
+// parameter.
+func parseProxySourceAddr(addr string) (*net.TCPAddr, error) {
+	host, port := addr, "0"
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, errors.New("invalid proxy source address: " + addr)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid proxy source address: " + addr)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// proxyHeader returns the PROXY protocol header for a connection from src to
+// dst. If they are not TCP addresses, e.g. of unix sockets, the header does
+// not carry addresses and the server uses the ones of the connection.
+func proxyHeader(version string, src, dst net.Addr) []byte {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	tcp := ok1 && ok2
+
+	srcIP, dstIP := net.IP(nil), net.IP(nil)
+	if tcp {
+		srcIP, dstIP = srcTCP.IP.To4(), dstTCP.IP.To4()
+		if srcIP == nil || dstIP == nil {
+			// mixed families are sent as IPv6
+			srcIP, dstIP = srcTCP.IP.To16(), dstTCP.IP.To16()
+		}
+		tcp = srcIP != nil && dstIP != nil
+	}
+
+	if version == proxyProtocolV1 {
+		if !tcp {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		family := "TCP4"
+		if len(srcIP) == net.IPv6len {
+			family = "TCP6"
+		}
+		return []byte("PROXY " + family + " " + proxyV1IP(srcIP) + " " + proxyV1IP(dstIP) + " " +
+			strconv.Itoa(srcTCP.Port) + " " + strconv.Itoa(dstTCP.Port) + "\r\n")
+	}
+
+	header := append([]byte(nil), proxyV2Signature...)
+	if !tcp {
+		// LOCAL command, unspecified family
+		return append(header, 0x20, 0x00, 0, 0)
+	}
+	family := byte(0x11) // TCP over IPv4
+	if len(srcIP) == net.IPv6len {
+		family = 0x21 // TCP over IPv6
+	}
+	length := 2*len(srcIP) + 4
+	header = append(header, 0x21, family, byte(length>>8), byte(length))
+	header = append(header, srcIP...)
+	header = append(header, dstIP...)
+	var ports [4]byte
+	binary.BigEndian.PutUint16(ports[:2], uint16(srcTCP.Port))
+	binary.BigEndian.PutUint16(ports[2:], uint16(dstTCP.Port))
+	return append(header, ports[:]...)
+}
+
+// proxyV1IP formats ip for v1 headers, which require IPv4-mapped addresses
+// in IPv6 notation.
+func proxyV1IP(ip net.IP) string {
+	if len(ip) == net.IPv6len {
+		if ip4 := ip.To4(); ip4 != nil {
+			return "::ffff:" + ip4.String()
+		}
+	}
+	return ip.String()
+}
+
+// writeProxyHeader sends the PROXY protocol header, which must precede the
+// handshake.
+func (mc *mysqlConn) writeProxyHeader() error {
+	src := mc.netConn.LocalAddr()
+	if mc.cfg.ProxySourceAddr != "" {
+		addr, err := parseProxySourceAddr(mc.cfg.ProxySourceAddr)
+		if err != nil {
+			return err
+		}
+		src = addr
+	}
+
+	if mc.cfg.WriteTimeout > 0 {
+		if err := mc.netConn.SetWriteDeadline(time.Now().Add(mc.cfg.WriteTimeout)); err != nil {
+			return err
+		}
+	}
+	_, err := mc.netConn.Write(proxyHeader(mc.cfg.ProxyProtocol, src, mc.netConn.RemoteAddr()))
+	return err
+}
@@ -0,0 +1,78 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+)
+
+func TestProxyHeader(t *testing.T) {
+	tcp4 := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}
+	tcp4Dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 3306}
+	tcp6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 3306}
+	unix := &net.UnixAddr{Name: "/tmp/mysql.sock", Net: "unix"}
+
+	tests := []struct {
+		version  string
+		src, dst net.Addr
+		expected []byte
+	}{
+		{"v1", tcp4, tcp4Dst, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 3306\r\n")},
+		{"v1", tcp4, tcp6, []byte("PROXY TCP6 ::ffff:192.0.2.1 2001:db8::1 56324 3306\r\n")},
+		{"v1", unix, unix, []byte("PROXY UNKNOWN\r\n")},
+		{"v2", tcp4, tcp4Dst, append(append([]byte(nil), proxyV2Signature...),
+			0x21, 0x11, 0, 12,
+			192, 0, 2, 1,
+			192, 0, 2, 2,
+			0xdc, 0x04, 0x0c, 0xea,
+		)},
+		{"v2", unix, unix, append(append([]byte(nil), proxyV2Signature...), 0x20, 0x00, 0, 0)},
+	}
+	for i, tt := range tests {
+		if header := proxyHeader(tt.version, tt.src, tt.dst); !bytes.Equal(header, tt.expected) {
+			t.Errorf("%d. expected %q, got %q", i, tt.expected, header)
+		}
+	}
+
+	// IPv6 addresses of v2
+	header := proxyHeader("v2", tcp6, tcp6)
+	if len(header) != 16+36 || header[13] != 0x21 || header[15] != 36 {
+		t.Errorf("unexpected IPv6 header %x", header)
+	}
+}
+
+func TestConnectorProxyProtocol(t *testing.T) {
+	var conn *mockConn
+	RegisterDialContext("proxyprotocol", func(ctx context.Context, addr string) (net.Conn, error) {
+		// the handshake is sent in reply to the header
+		conn = newHandshakeMockConn()
+		conn.queuedReplies = append([][]byte{testHandshake}, conn.queuedReplies...)
+		conn.laddr = &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 40000}
+		conn.raddr = &net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 3306}
+		return conn, nil
+	})
+
+	cfg, err := ParseDSN("proxyprotocol(db)/?proxyProtocol=v1&proxySourceAddr=203.0.113.7%3A51000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newConnector(cfg).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	expected := []byte("PROXY TCP4 203.0.113.7 10.0.0.9 51000 3306\r\n")
+	if !bytes.HasPrefix(conn.written, expected) {
+		t.Errorf("expected the header before the handshake response, got %q", conn.written)
+	}
+}
@@ -0,0 +1,53 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"sort"
+)
+
+type queryAttrsKey struct{}
+
+// WithQueryAttributes returns a copy of ctx which attaches the given query
+// attributes to the statements run with it. Query attributes are supported
+// by MySQL 8.0.23+ (CLIENT_QUERY_ATTRIBUTES) and can be read on the server,
+// e.g. with mysql_query_attribute_string() or by the audit log:
+//
+//	ctx = mysql.WithQueryAttributes(ctx, map[string]string{"request_id": id})
+//	_, err = db.ExecContext(ctx, "UPDATE accounts SET balance = ? WHERE id = ?", balance, account)
+//
+// The attributes are silently dropped if the server does not support them.
+func WithQueryAttributes(ctx context.Context, attrs map[string]string) context.Context {
+	return context.WithValue(ctx, queryAttrsKey{}, attrs)
+}
+
+func queryAttributesFromContext(ctx context.Context) map[string]string {
+	attrs, _ := ctx.Value(queryAttrsKey{}).(map[string]string)
+	return attrs
+}
+
+// clearQueryAttributes removes the query attributes if no command used them
+func (mc *mysqlConn) clearQueryAttributes() {
+	mc.queryAttrs = nil
+}
+
+// sortedAttributeNames returns the names of the query attributes in the
+// order they are sent in
+func sortedAttributeNames(attrs map[string]string) []string {
+	if len(attrs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
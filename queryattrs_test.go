@@ -0,0 +1,86 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestWriteQueryPacketAttributes(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	mc.flags = clientQueryAttributes
+
+	// without attributes only the counts are sent
+	if err := mc.writeQueryPacket("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	expected := append([]byte{11, 0, 0, 0, comQuery, 0, 1}, "SELECT 1"...)
+	if !bytes.Equal(conn.written, expected) {
+		t.Errorf("unexpected packet:\ngot  %v\nwant %v", conn.written, expected)
+	}
+
+	conn.written = nil
+	mc.queryAttrs = map[string]string{"b": "yz", "a": "x"}
+	if err := mc.writeQueryPacket("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	expected = []byte{26, 0, 0, 0, comQuery,
+		2, 1, // parameter_count, parameter_set_count
+		0, 1, // NULL-bitmap, new_params_bind_flag
+		byte(fieldTypeString), 0, 1, 'a', byte(fieldTypeString), 0, 1, 'b',
+		1, 'x', 2, 'y', 'z',
+	}
+	expected = append(expected, "SELECT 1"...)
+	if !bytes.Equal(conn.written, expected) {
+		t.Errorf("unexpected packet:\ngot  %v\nwant %v", conn.written, expected)
+	}
+	if mc.queryAttrs != nil {
+		t.Error("query attributes were not consumed")
+	}
+}
+
+func TestWriteExecutePacketAttributes(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	mc.flags = clientQueryAttributes
+	mc.queryAttrs = map[string]string{"a": "x"}
+	stmt := &mysqlStmt{mc: mc, id: 1, paramCount: 1}
+
+	if err := stmt.writeExecutePacket([]driver.Value{int64(5)}, cursorTypeNoCursor); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{30, 0, 0, 0, comStmtExecute,
+		1, 0, 0, 0, // statement_id
+		parameterCountAvailable,
+		1, 0, 0, 0, // iteration_count
+		2,    // parameter_count
+		0, 1, // NULL-bitmap, new_params_bind_flag
+		byte(fieldTypeLongLong), 0, 0, byte(fieldTypeString), 0, 1, 'a',
+		5, 0, 0, 0, 0, 0, 0, 0, 1, 'x',
+	}
+	if !bytes.Equal(conn.written, expected) {
+		t.Errorf("unexpected packet:\ngot  %v\nwant %v", conn.written, expected)
+	}
+}
+
+func TestQueryAttributesCleared(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	conn.data = []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+	ctx := WithQueryAttributes(context.Background(), map[string]string{"a": "x"})
+
+	// the server does not support query attributes
+	if _, err := mc.ExecContext(ctx, "DO 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if mc.queryAttrs != nil {
+		t.Error("query attributes were not cleared")
+	}
+}
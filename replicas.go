@@ -0,0 +1,430 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultHealthCheckInterval = 5 * time.Second
+
+// ReadWriteConfig is the configuration of a connector which splits reads
+// and writes between a primary and its replicas.
+type ReadWriteConfig struct {
+	Primary  *Config   // Config of the primary
+	Replicas []*Config // Configs of the replicas
+
+	// HealthCheckInterval is the interval in which the replicas are checked
+	// when they are used. Defaults to 5s.
+	HealthCheckInterval time.Duration
+
+	// MaxReplicationLag is the maximum Seconds_Behind_Source of a replica.
+	// Replicas which lag behind further are evicted until their next health
+	// check. 0 disables the check of the replication lag.
+	MaxReplicationLag time.Duration
+}
+
+// NewReadWriteConnector returns a driver.Connector, which sends read-only
+// transactions and queries run with a context of WithReplica to a replica
+// and everything else to the primary.
+//
+// Each connection of the sql.DB is connected to the primary and, once it
+// runs a read, to one of the healthy replicas, which are chosen round-robin.
+// If no replica is healthy, reads go to the primary.
+//
+//	db := sql.OpenDB(connector)
+//	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}) // replica
+//	rows, err := db.QueryContext(mysql.WithReplica(ctx), "SELECT ...") // replica
+//	_, err = db.ExecContext(ctx, "UPDATE ...") // primary
+func NewReadWriteConnector(cfg *ReadWriteConfig) (driver.Connector, error) {
+	primary, err := NewConnector(cfg.Primary)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := &replicaPool{
+		interval: cfg.HealthCheckInterval,
+		maxLag:   cfg.MaxReplicationLag,
+	}
+	if pool.interval <= 0 {
+		pool.interval = defaultHealthCheckInterval
+	}
+	for _, replicaCfg := range cfg.Replicas {
+		c, err := NewConnector(replicaCfg)
+		if err != nil {
+			return nil, err
+		}
+		pool.replicas = append(pool.replicas, &replica{connector: c.(*connector)})
+	}
+
+	return &rwConnector{primary: primary.(*connector), replicas: pool}, nil
+}
+
+type replicaKey struct{}
+
+// WithReplica returns a copy of ctx which makes queries and statements
+// prepared with it run on a replica of a connector of NewReadWriteConnector.
+// Exec always runs on the primary. Exec of a statement prepared on a replica
+// prepares it on the primary again.
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+func replicaFromContext(ctx context.Context) bool {
+	replica, _ := ctx.Value(replicaKey{}).(bool)
+	return replica
+}
+
+type replica struct {
+	connector *connector
+	healthy   bool
+	checked   time.Time
+}
+
+// replicaPool tracks the health of the replicas. Replicas are checked when a
+// connection to them is used and the last check is older than the interval.
+type replicaPool struct {
+	interval time.Duration
+	maxLag   time.Duration
+
+	mu       sync.Mutex
+	replicas []*replica
+	next     int
+}
+
+// connect connects to the next healthy replica. It returns nil if no replica
+// is available.
+func (p *replicaPool) connect(ctx context.Context) (*mysqlConn, int) {
+	p.mu.Lock()
+	start := p.next
+	p.next++
+	p.mu.Unlock()
+
+	for i := range p.replicas {
+		idx := (start + i) % len(p.replicas)
+		if !p.available(idx) {
+			continue
+		}
+		conn, err := p.replicas[idx].connector.Connect(ctx)
+		if err != nil && ctx.Err() != nil {
+			return nil, -1
+		}
+		if err != nil {
+			errLog.Print("could not connect to replica: ", err)
+			p.setHealthy(idx, false)
+			continue
+		}
+		mc := conn.(*mysqlConn)
+		if p.check(ctx, idx, mc) {
+			return mc, idx
+		}
+		mc.Close()
+	}
+	return nil, -1
+}
+
+// available reports whether the replica is healthy or due for a check.
+func (p *replicaPool) available(idx int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.replicas[idx]
+	return r.healthy || time.Since(r.checked) >= p.interval
+}
+
+func (p *replicaPool) setHealthy(idx int, healthy bool) {
+	p.mu.Lock()
+	p.replicas[idx].healthy = healthy
+	p.replicas[idx].checked = time.Now()
+	p.mu.Unlock()
+}
+
+// check reports whether the replica is healthy and checks it with mc if
+// the last check is older than the interval.
+func (p *replicaPool) check(ctx context.Context, idx int, mc *mysqlConn) bool {
+	p.mu.Lock()
+	r := p.replicas[idx]
+	healthy, due := r.healthy, time.Since(r.checked) >= p.interval
+	p.mu.Unlock()
+	if !due {
+		return healthy
+	}
+
+	err := p.healthCheck(ctx, mc)
+	if err != nil && ctx.Err() != nil {
+		// the caller gave up, which says nothing about the replica
+		return false
+	}
+	if err != nil {
+		errLog.Print("evicting replica ", mc.cfg.Addr, ": ", err)
+	}
+	p.setHealthy(idx, err == nil)
+	return err == nil
+}
+
+func (p *replicaPool) healthCheck(ctx context.Context, mc *mysqlConn) error {
+	if p.maxLag <= 0 {
+		return mc.Ping(ctx)
+	}
+	lag, err := mc.replicationLag(ctx)
+	if err != nil {
+		return err
+	}
+	if lag > p.maxLag {
+		return fmt.Errorf("replication lag of %v exceeds %v", lag, p.maxLag)
+	}
+	return nil
+}
+
+// replicationLag returns the Seconds_Behind_Source of SHOW REPLICA STATUS.
+func (mc *mysqlConn) replicationLag(ctx context.Context) (time.Duration, error) {
+	if err := mc.watchCancel(ctx); err != nil {
+		return 0, err
+	}
+	defer mc.finish()
+
+	rows, err := mc.query("SHOW REPLICA STATUS", nil)
+	if me, ok := err.(*MySQLError); ok && me.Number == 1064 {
+		// servers before MySQL 8.0.22 and MariaDB 10.5.1
+		rows, err = mc.query("SHOW SLAVE STATUS", nil)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns := rows.Columns()
+	dest := make([]driver.Value, len(columns))
+	if err = rows.Next(dest); err != nil {
+		if err == io.EOF {
+			return 0, errors.New("server is not a replica")
+		}
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if dest[i] == nil {
+			return 0, errors.New("replication is not running")
+		}
+		b, _ := dest[i].([]byte)
+		seconds, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("replica status without Seconds_Behind_Source")
+}
+
+type rwConnector struct {
+	primary  *connector
+	replicas *replicaPool
+}
+
+// Connect implements driver.Connector interface.
+func (c *rwConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	primary, err := c.primary.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rwConn{primary: primary.(*mysqlConn), pool: c.replicas}, nil
+}
+
+// Driver implements driver.Connector interface.
+func (c *rwConnector) Driver() driver.Driver {
+	return &MySQLDriver{}
+}
+
+// rwConn routes the statements to a connection to the primary or a replica.
+type rwConn struct {
+	primary    *mysqlConn
+	replica    *mysqlConn
+	replicaIdx int
+	pool       *replicaPool
+	tx         *mysqlConn // connection of the running transaction
+}
+
+// replicaConn returns the connection to a healthy replica or nil.
+func (rc *rwConn) replicaConn(ctx context.Context) *mysqlConn {
+	if rc.replica != nil {
+		if !rc.replica.closed.IsSet() && rc.pool.check(ctx, rc.replicaIdx, rc.replica) {
+			return rc.replica
+		}
+		rc.replica.Close()
+		rc.replica = nil
+	}
+	rc.replica, rc.replicaIdx = rc.pool.connect(ctx)
+	return rc.replica
+}
+
+// dropReplica closes the connection to the replica after it returned
+// driver.ErrBadConn, so that the read can be retried on another replica or
+// the primary instead of database/sql discarding the whole connection. The
+// replica is evicted until its next check. It reports whether the read can
+// be retried.
+func (rc *rwConn) dropReplica(mc *mysqlConn, err error) bool {
+	if err != driver.ErrBadConn || mc != rc.replica || rc.tx != nil {
+		return false
+	}
+	errLog.Print("evicting replica ", mc.cfg.Addr, ": ", err)
+	rc.pool.setHealthy(rc.replicaIdx, false)
+	rc.replica.Close()
+	rc.replica = nil
+	return true
+}
+
+// conn returns the connection to run reads with ctx on.
+func (rc *rwConn) conn(ctx context.Context) *mysqlConn {
+	if rc.tx != nil {
+		return rc.tx
+	}
+	if replicaFromContext(ctx) {
+		if mc := rc.replicaConn(ctx); mc != nil {
+			return mc
+		}
+	}
+	return rc.primary
+}
+
+// writeConn returns the connection to run writes on.
+func (rc *rwConn) writeConn() *mysqlConn {
+	if rc.tx != nil {
+		return rc.tx
+	}
+	return rc.primary
+}
+
+func (rc *rwConn) Prepare(query string) (driver.Stmt, error) {
+	return rc.writeConn().Prepare(query)
+}
+
+func (rc *rwConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	for {
+		mc := rc.conn(ctx)
+		stmt, err := mc.PrepareContext(ctx, query)
+		if rc.dropReplica(mc, err) {
+			continue
+		}
+		if err == nil && mc == rc.replica && rc.tx == nil {
+			stmt = &replicaStmt{mysqlStmt: stmt.(*mysqlStmt), rc: rc, query: query}
+		}
+		return stmt, err
+	}
+}
+
+func (rc *rwConn) Begin() (driver.Tx, error) {
+	return rc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (rc *rwConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	for {
+		mc := rc.primary
+		if opts.ReadOnly {
+			if replica := rc.replicaConn(ctx); replica != nil {
+				mc = replica
+			}
+		}
+		tx, err := mc.BeginTx(ctx, opts)
+		if err != nil {
+			if rc.dropReplica(mc, err) {
+				continue
+			}
+			return nil, err
+		}
+		rc.tx = mc
+		return &rwTx{tx: tx, rc: rc}, nil
+	}
+}
+
+func (rc *rwConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	for {
+		mc := rc.conn(ctx)
+		rows, err := mc.QueryContext(ctx, query, args)
+		if !rc.dropReplica(mc, err) {
+			return rows, err
+		}
+	}
+}
+
+func (rc *rwConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return rc.writeConn().ExecContext(ctx, query, args)
+}
+
+func (rc *rwConn) Ping(ctx context.Context) error {
+	return rc.primary.Ping(ctx)
+}
+
+func (rc *rwConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return rc.primary.CheckNamedValue(nv)
+}
+
+func (rc *rwConn) ResetSession(ctx context.Context) error {
+	if rc.replica != nil && rc.replica.ResetSession(ctx) != nil {
+		// the next read connects to another replica
+		rc.replica.Close()
+		rc.replica = nil
+	}
+	return rc.primary.ResetSession(ctx)
+}
+
+func (rc *rwConn) Close() error {
+	if rc.replica != nil {
+		rc.replica.Close()
+	}
+	return rc.primary.Close()
+}
+
+// replicaStmt is a statement prepared on a replica. Exec prepares it on the
+// primary again, since writes must not go to a replica.
+type replicaStmt struct {
+	*mysqlStmt
+	rc    *rwConn
+	query string
+}
+
+func (stmt *replicaStmt) Exec(args []driver.Value) (driver.Result, error) {
+	primaryStmt, err := stmt.rc.writeConn().Prepare(stmt.query)
+	if err != nil {
+		return nil, err
+	}
+	defer primaryStmt.Close()
+	return primaryStmt.Exec(args)
+}
+
+func (stmt *replicaStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	primaryStmt, err := stmt.rc.writeConn().PrepareContext(ctx, stmt.query)
+	if err != nil {
+		return nil, err
+	}
+	defer primaryStmt.Close()
+	return primaryStmt.(*mysqlStmt).ExecContext(ctx, args)
+}
+
+type rwTx struct {
+	tx driver.Tx
+	rc *rwConn
+}
+
+func (tx *rwTx) Commit() error {
+	tx.rc.tx = nil
+	return tx.tx.Commit()
+}
+
+func (tx *rwTx) Rollback() error {
+	tx.rc.tx = nil
+	return tx.tx.Rollback()
+}
@@ -0,0 +1,223 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"net"
+	"testing"
+	"time"
+)
+
+// testReplicaStatus returns the result set of SHOW REPLICA STATUS
+func testReplicaStatus(lag string) []byte {
+	b := appendTestPacket(nil, 1, []byte{1})
+	b = appendTestPacket(b, 2, testColumnDefinition("Seconds_Behind_Source", fieldTypeLongLong))
+	b = appendTestPacket(b, 3, []byte{iEOF, 0, 0, 2, 0})
+	b = appendTestPacket(b, 4, append([]byte{byte(len(lag))}, lag...))
+	return appendTestPacket(b, 5, []byte{iEOF, 0, 0, 2, 0})
+}
+
+func newTestReadWriteConnector(t *testing.T, maxLag time.Duration, replicas ...string) (driver.Connector, map[string]*mockConn) {
+	okPkt := []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+	conns := make(map[string]*mockConn)
+	RegisterDialContext("rwsplit", func(ctx context.Context, addr string) (net.Conn, error) {
+		var conn *mockConn
+		switch addr {
+		case "primary":
+			conn = newHandshakeMockConn(okPkt, okPkt, okPkt)
+		case "lagging":
+			conn = newHandshakeMockConn(testReplicaStatus("120"))
+		default:
+			conn = newHandshakeMockConn(testReplicaStatus("0"), okPkt, okPkt)
+			if maxLag == 0 {
+				conn.queuedReplies[1] = okPkt // ping
+			}
+		}
+		conns[addr] = conn
+		return conn, nil
+	})
+
+	newConfig := func(addr string) *Config {
+		cfg := NewConfig()
+		cfg.Net = "rwsplit"
+		cfg.Addr = addr
+		return cfg
+	}
+	cfg := &ReadWriteConfig{Primary: newConfig("primary"), MaxReplicationLag: maxLag}
+	for _, addr := range replicas {
+		cfg.Replicas = append(cfg.Replicas, newConfig(addr))
+	}
+	c, err := NewReadWriteConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, conns
+}
+
+func TestReadWriteConnectorRouting(t *testing.T) {
+	c, conns := newTestReadWriteConnector(t, 0, "replica")
+	ctx := context.Background()
+	conn, err := c.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rc := conn.(*rwConn)
+
+	if rc.conn(ctx) != rc.primary {
+		t.Error("untagged reads should run on the primary")
+	}
+	if mc := rc.conn(WithReplica(ctx)); mc == rc.primary || mc.cfg.Addr != "replica" {
+		t.Error("tagged reads should run on the replica")
+	}
+
+	tx, err := rc.BeginTx(ctx, driver.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.conn(ctx) != rc.replica || rc.writeConn() != rc.replica {
+		t.Error("statements of a read-only transaction should run on the replica")
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(conns["replica"].written, []byte("START TRANSACTION READ ONLY")) {
+		t.Errorf("read-only transaction was not started on the replica: %q", conns["replica"].written)
+	}
+
+	if _, err = rc.ExecContext(WithReplica(ctx), "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(conns["primary"].written, []byte("UPDATE t SET a = 1")) {
+		t.Errorf("writes should run on the primary: %q", conns["primary"].written)
+	}
+}
+
+func TestReadWriteConnectorLag(t *testing.T) {
+	c, _ := newTestReadWriteConnector(t, time.Minute, "lagging", "replica")
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rc := conn.(*rwConn)
+
+	if mc := rc.conn(WithReplica(context.Background())); mc.cfg.Addr != "replica" {
+		t.Errorf("expected the lagging replica to be evicted, got %q", mc.cfg.Addr)
+	}
+	if rc.pool.available(0) || !rc.pool.available(1) {
+		t.Error("unexpected health of the replicas")
+	}
+
+	// reads fall back to the primary if no replica is healthy
+	rc.replica.Close()
+	rc.pool.setHealthy(1, false)
+	if mc := rc.conn(WithReplica(context.Background())); mc != rc.primary {
+		t.Errorf("expected the primary, got %q", mc.cfg.Addr)
+	}
+}
+
+func TestReadWriteConnectorBadReplica(t *testing.T) {
+	c, conns := newTestReadWriteConnector(t, 0, "replica")
+	ctx := WithReplica(context.Background())
+	conn, err := c.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rc := conn.(*rwConn)
+
+	if mc := rc.conn(ctx); mc.cfg.Addr != "replica" {
+		t.Fatalf("expected the replica, got %q", mc.cfg.Addr)
+	}
+	replica := conns["replica"]
+	replica.maxWrites = replica.writes
+
+	// the read is retried on the primary, which stays usable
+	if _, err = rc.QueryContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatalf("expected the read to be retried, got %v", err)
+	}
+	if !bytes.Contains(conns["primary"].written, []byte("SELECT 1")) {
+		t.Errorf("the read was not retried on the primary: %q", conns["primary"].written)
+	}
+	if rc.replica != nil || !replica.closed || rc.pool.available(0) {
+		t.Error("the replica was not evicted")
+	}
+}
+
+func TestReadWriteConnectorReplicaStmtExec(t *testing.T) {
+	c, conns := newTestReadWriteConnector(t, 0, "replica")
+	ctx := WithReplica(context.Background())
+	conn, err := c.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rc := conn.(*rwConn)
+	if mc := rc.conn(ctx); mc.cfg.Addr != "replica" {
+		t.Fatalf("expected the replica, got %q", mc.cfg.Addr)
+	}
+
+	// statement 1 without columns and parameters
+	prepareOK := []byte{12, 0, 0, 1, iOK, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	okPkt := []byte{7, 0, 0, 1, iOK, 1, 0, 2, 0, 0, 0}
+	conns["replica"].queuedReplies = [][]byte{prepareOK}
+	conns["primary"].queuedReplies = [][]byte{prepareOK, okPkt}
+
+	stmt, err := rc.PrepareContext(ctx, "UPDATE t SET a = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	res, err := stmt.(driver.StmtExecContext).ExecContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("expected 1 affected row, got %d", n)
+	}
+
+	if !bytes.Contains(conns["primary"].written, append([]byte{comStmtPrepare}, "UPDATE t SET a = 1"...)) {
+		t.Errorf("the statement was not prepared on the primary: %q", conns["primary"].written)
+	}
+	if !bytes.Contains(conns["primary"].written, []byte{comStmtExecute, 1, 0, 0, 0}) {
+		t.Errorf("the statement was not executed on the primary: %q", conns["primary"].written)
+	}
+	if bytes.Contains(conns["replica"].written, []byte{comStmtExecute}) {
+		t.Errorf("the statement was executed on the replica: %q", conns["replica"].written)
+	}
+}
+
+func TestReadWriteConnectorCheckCanceled(t *testing.T) {
+	c, _ := newTestReadWriteConnector(t, 0, "replica")
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rc := conn.(*rwConn)
+	if mc := rc.conn(WithReplica(context.Background())); mc.cfg.Addr != "replica" {
+		t.Fatalf("expected the replica, got %q", mc.cfg.Addr)
+	}
+
+	// the check uses the context of the caller, whose cancellation does not
+	// evict the replica
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rc.pool.replicas[0].checked = time.Time{}
+	if rc.pool.check(ctx, 0, rc.replica) {
+		t.Error("the check succeeded with a canceled context")
+	}
+	if !rc.pool.replicas[0].healthy {
+		t.Error("the replica was evicted because the context was canceled")
+	}
+}
@@ -0,0 +1,321 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package replication
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"strconv"
+)
+
+var (
+	// ErrChecksum is returned if the checksum of an event does not match
+	ErrChecksum = errors.New("replication: event checksum mismatch")
+
+	// ErrMalformEvent is returned for events which cannot be decoded
+	ErrMalformEvent = errors.New("replication: malformed event")
+)
+
+// EventType is the type of a binlog event.
+// https://dev.mysql.com/doc/internals/en/binlog-event-type.html
+type EventType byte
+
+// Binlog event types
+const (
+	EventUnknown           EventType = 0
+	EventQuery             EventType = 2
+	EventStop              EventType = 3
+	EventRotate            EventType = 4
+	EventFormatDescription EventType = 15
+	EventXID               EventType = 16
+	EventTableMap          EventType = 19
+	EventWriteRowsV1       EventType = 23
+	EventUpdateRowsV1      EventType = 24
+	EventDeleteRowsV1      EventType = 25
+	EventHeartbeat         EventType = 27
+	EventRowsQuery         EventType = 29
+	EventWriteRows         EventType = 30
+	EventUpdateRows        EventType = 31
+	EventDeleteRows        EventType = 32
+	EventGTID              EventType = 33
+	EventAnonymousGTID     EventType = 34
+	EventPreviousGTIDs     EventType = 35
+)
+
+var eventTypeNames = map[EventType]string{
+	EventQuery:             "QUERY",
+	EventStop:              "STOP",
+	EventRotate:            "ROTATE",
+	EventFormatDescription: "FORMAT_DESCRIPTION",
+	EventXID:               "XID",
+	EventTableMap:          "TABLE_MAP",
+	EventWriteRowsV1:       "WRITE_ROWS_V1",
+	EventUpdateRowsV1:      "UPDATE_ROWS_V1",
+	EventDeleteRowsV1:      "DELETE_ROWS_V1",
+	EventHeartbeat:         "HEARTBEAT",
+	EventRowsQuery:         "ROWS_QUERY",
+	EventWriteRows:         "WRITE_ROWS",
+	EventUpdateRows:        "UPDATE_ROWS",
+	EventDeleteRows:        "DELETE_ROWS",
+	EventGTID:              "GTID",
+	EventAnonymousGTID:     "ANONYMOUS_GTID",
+	EventPreviousGTIDs:     "PREVIOUS_GTIDS",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "UNKNOWN_EVENT(" + strconv.Itoa(int(t)) + ")"
+}
+
+const (
+	eventHeaderSize = 19
+
+	// checksum algorithms of the FORMAT_DESCRIPTION event
+	checksumAlgOff   = 0
+	checksumAlgCRC32 = 1
+	checksumSize     = 4
+)
+
+// EventHeader is the common header of all binlog events.
+type EventHeader struct {
+	Timestamp uint32    // Time the statement started, in seconds since the Unix epoch
+	Type      EventType // Type of the event
+	ServerID  uint32    // Server id of the server which created the event
+	EventSize uint32    // Size of the event including the header
+	LogPos    uint32    // Position of the next event in the binlog file
+	Flags     uint16    // Event flags
+}
+
+// Event is a binlog event.
+type Event struct {
+	Header EventHeader
+
+	// Data holds the decoded event, one of *FormatDescriptionEvent,
+	// *RotateEvent, *QueryEvent, *XIDEvent, *GTIDEvent, *TableMapEvent or
+	// *RowsEvent. It is nil for other event types.
+	Data interface{}
+
+	// Raw is the complete event, including the header and the checksum
+	Raw []byte
+}
+
+// FormatDescriptionEvent is the first event of every binlog file.
+type FormatDescriptionEvent struct {
+	BinlogVersion     uint16
+	ServerVersion     string
+	CreateTimestamp   uint32
+	HeaderLength      uint8
+	PostHeaderLengths []byte
+	ChecksumAlgorithm byte // 0: none, 1: CRC32
+}
+
+// RotateEvent announces the next binlog file.
+type RotateEvent struct {
+	Position uint64 // Position of the first event in the next file
+	NextFile string // Name of the next binlog file
+}
+
+// QueryEvent is written for statements, e.g. DDL and BEGIN.
+type QueryEvent struct {
+	ThreadID      uint32
+	ExecutionTime uint32
+	ErrorCode     uint16
+	StatusVars    []byte
+	Schema        string
+	Query         string
+}
+
+// XIDEvent is written when a transaction is committed.
+type XIDEvent struct {
+	XID uint64
+}
+
+// GTIDEvent precedes every transaction if GTIDs are enabled.
+type GTIDEvent struct {
+	Flags byte
+	SID   [16]byte // UUID of the server which committed the transaction
+	GNO   int64    // Transaction number
+}
+
+// GTID returns the GTID in the usual format, e.g.
+// "3e11fa47-71ca-11e1-9e33-c80aa9429562:23".
+func (e *GTIDEvent) GTID() string {
+	return formatUUID(e.SID[:]) + ":" + strconv.FormatInt(e.GNO, 10)
+}
+
+func formatUUID(sid []byte) string {
+	s := hex.EncodeToString(sid)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// parseEvent decodes an event. The event is checked against its checksum.
+func (s *Stream) parseEvent(raw []byte) (*Event, error) {
+	if len(raw) < eventHeaderSize {
+		return nil, ErrMalformEvent
+	}
+
+	ev := &Event{
+		Header: EventHeader{
+			Timestamp: binary.LittleEndian.Uint32(raw[0:]),
+			Type:      EventType(raw[4]),
+			ServerID:  binary.LittleEndian.Uint32(raw[5:]),
+			EventSize: binary.LittleEndian.Uint32(raw[9:]),
+			LogPos:    binary.LittleEndian.Uint32(raw[13:]),
+			Flags:     binary.LittleEndian.Uint16(raw[17:]),
+		},
+		Raw: raw,
+	}
+	if int(ev.Header.EventSize) != len(raw) {
+		return nil, ErrMalformEvent
+	}
+
+	// The FORMAT_DESCRIPTION event tells if the events of the file have checksums
+	if ev.Header.Type == EventFormatDescription {
+		fde, err := parseFormatDescriptionEvent(raw)
+		if err != nil {
+			return nil, err
+		}
+		s.checksum = fde.ChecksumAlgorithm == checksumAlgCRC32
+		ev.Data = fde
+	}
+
+	data := raw[eventHeaderSize:]
+	if s.checksum {
+		if len(data) < checksumSize {
+			return nil, ErrMalformEvent
+		}
+		n := len(raw) - checksumSize
+		if crc32.ChecksumIEEE(raw[:n]) != binary.LittleEndian.Uint32(raw[n:]) {
+			return nil, ErrChecksum
+		}
+		data = data[:len(data)-checksumSize]
+	}
+
+	var err error
+	switch ev.Header.Type {
+	case EventRotate:
+		ev.Data, err = parseRotateEvent(data)
+	case EventQuery:
+		ev.Data, err = parseQueryEvent(data)
+	case EventXID:
+		if len(data) < 8 {
+			return nil, ErrMalformEvent
+		}
+		ev.Data = &XIDEvent{XID: binary.LittleEndian.Uint64(data)}
+	case EventGTID, EventAnonymousGTID:
+		ev.Data, err = parseGTIDEvent(data)
+	case EventTableMap:
+		var tm *TableMapEvent
+		if tm, err = parseTableMapEvent(data); err == nil {
+			s.tables[tm.TableID] = tm
+			ev.Data = tm
+		}
+	case EventWriteRowsV1, EventUpdateRowsV1, EventDeleteRowsV1,
+		EventWriteRows, EventUpdateRows, EventDeleteRows:
+		ev.Data, err = s.parseRowsEvent(ev.Header.Type, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// https://dev.mysql.com/doc/internals/en/format-description-event.html
+func parseFormatDescriptionEvent(raw []byte) (*FormatDescriptionEvent, error) {
+	data := raw[eventHeaderSize:]
+
+	// binlog version [2 bytes], server version [50 bytes],
+	// create timestamp [4 bytes], header length [1 byte]
+	const fixedLen = 2 + 50 + 4 + 1
+	if len(data) < fixedLen {
+		return nil, ErrMalformEvent
+	}
+
+	fde := &FormatDescriptionEvent{
+		BinlogVersion:   binary.LittleEndian.Uint16(data),
+		CreateTimestamp: binary.LittleEndian.Uint32(data[52:]),
+		HeaderLength:    data[56],
+	}
+	version := data[2:52]
+	for i, b := range version {
+		if b == 0 {
+			version = version[:i]
+			break
+		}
+	}
+	fde.ServerVersion = string(version)
+
+	// post header lengths, followed by the checksum algorithm [1 byte] and
+	// the checksum [4 bytes] (since MySQL 5.6.1)
+	rest := data[fixedLen:]
+	if len(rest) < 1+checksumSize {
+		fde.PostHeaderLengths = rest
+		return fde, nil
+	}
+	fde.PostHeaderLengths = rest[:len(rest)-1-checksumSize]
+	fde.ChecksumAlgorithm = rest[len(rest)-1-checksumSize]
+	return fde, nil
+}
+
+// https://dev.mysql.com/doc/internals/en/rotate-event.html
+func parseRotateEvent(data []byte) (*RotateEvent, error) {
+	if len(data) < 8 {
+		return nil, ErrMalformEvent
+	}
+	return &RotateEvent{
+		Position: binary.LittleEndian.Uint64(data),
+		NextFile: string(data[8:]),
+	}, nil
+}
+
+// https://dev.mysql.com/doc/internals/en/query-event.html
+func parseQueryEvent(data []byte) (*QueryEvent, error) {
+	// thread id [4 bytes], execution time [4 bytes], schema length [1 byte],
+	// error code [2 bytes], status vars length [2 bytes]
+	const postHeaderLen = 4 + 4 + 1 + 2 + 2
+	if len(data) < postHeaderLen {
+		return nil, ErrMalformEvent
+	}
+
+	ev := &QueryEvent{
+		ThreadID:      binary.LittleEndian.Uint32(data),
+		ExecutionTime: binary.LittleEndian.Uint32(data[4:]),
+		ErrorCode:     binary.LittleEndian.Uint16(data[9:]),
+	}
+	schemaLen := int(data[8])
+	statusLen := int(binary.LittleEndian.Uint16(data[11:]))
+	data = data[postHeaderLen:]
+
+	// status vars, schema, 0x00, query
+	if len(data) < statusLen+schemaLen+1 {
+		return nil, ErrMalformEvent
+	}
+	ev.StatusVars = data[:statusLen]
+	ev.Schema = string(data[statusLen : statusLen+schemaLen])
+	ev.Query = string(data[statusLen+schemaLen+1:])
+	return ev, nil
+}
+
+func parseGTIDEvent(data []byte) (*GTIDEvent, error) {
+	// flags [1 byte], sid [16 bytes], gno [8 bytes], followed by the
+	// logical clock which is not decoded
+	if len(data) < 1+16+8 {
+		return nil, ErrMalformEvent
+	}
+	ev := &GTIDEvent{
+		Flags: data[0],
+		GNO:   int64(binary.LittleEndian.Uint64(data[17:])),
+	}
+	copy(ev.SID[:], data[1:17])
+	return ev, nil
+}
@@ -0,0 +1,161 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package replication
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func newTestStream(checksum bool) *Stream {
+	return &Stream{
+		checksum: checksum,
+		tables:   make(map[uint64]*TableMapEvent),
+	}
+}
+
+// testEvent returns an event with the given type and data
+func testEvent(typ EventType, data []byte, checksum bool) []byte {
+	size := eventHeaderSize + len(data)
+	if checksum {
+		size += checksumSize
+	}
+	ev := make([]byte, eventHeaderSize, size)
+	binary.LittleEndian.PutUint32(ev[0:], 1588888888) // timestamp
+	ev[4] = byte(typ)
+	binary.LittleEndian.PutUint32(ev[5:], 1) // server id
+	binary.LittleEndian.PutUint32(ev[9:], uint32(size))
+	binary.LittleEndian.PutUint32(ev[13:], 1000) // log pos
+	ev = append(ev, data...)
+	if checksum {
+		var crc [4]byte
+		binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(ev))
+		ev = append(ev, crc[:]...)
+	}
+	return ev
+}
+
+func testFormatDescription(checksumAlg byte) []byte {
+	data := make([]byte, 2+50+4+1)
+	binary.LittleEndian.PutUint16(data, 4)
+	copy(data[2:], "8.0.20")
+	data[56] = eventHeaderSize
+	data = append(data, make([]byte, 40)...) // post header lengths
+	return append(data, checksumAlg)
+}
+
+func TestParseFormatDescriptionEvent(t *testing.T) {
+	s := newTestStream(false)
+	ev, err := s.parseEvent(testEvent(EventFormatDescription, testFormatDescription(checksumAlgCRC32), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fde, ok := ev.Data.(*FormatDescriptionEvent)
+	if !ok {
+		t.Fatalf("expected *FormatDescriptionEvent, got %T", ev.Data)
+	}
+	if fde.BinlogVersion != 4 || fde.ServerVersion != "8.0.20" || fde.ChecksumAlgorithm != checksumAlgCRC32 {
+		t.Errorf("unexpected format description: %+v", fde)
+	}
+	if !s.checksum {
+		t.Error("checksums were not enabled")
+	}
+
+	// the checksum of following events is verified
+	ev, err = s.parseEvent(testEvent(EventXID, []byte{42, 0, 0, 0, 0, 0, 0, 0}, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xid := ev.Data.(*XIDEvent).XID; xid != 42 {
+		t.Errorf("expected xid 42, got %d", xid)
+	}
+
+	raw := testEvent(EventXID, []byte{42, 0, 0, 0, 0, 0, 0, 0}, true)
+	raw[eventHeaderSize] = 43
+	if _, err = s.parseEvent(raw); err != ErrChecksum {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+
+	// a file without checksums disables them again
+	if _, err = s.parseEvent(testEvent(EventFormatDescription, testFormatDescription(checksumAlgOff), true)); err != nil {
+		t.Fatal(err)
+	}
+	if s.checksum {
+		t.Error("checksums were not disabled")
+	}
+}
+
+func TestParseRotateEvent(t *testing.T) {
+	s := newTestStream(false)
+	data := append([]byte{4, 0, 0, 0, 0, 0, 0, 0}, "binlog.000002"...)
+	ev, err := s.parseEvent(testEvent(EventRotate, data, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotate := ev.Data.(*RotateEvent)
+	if rotate.Position != 4 || rotate.NextFile != "binlog.000002" {
+		t.Errorf("unexpected rotate event: %+v", rotate)
+	}
+}
+
+func TestParseQueryEvent(t *testing.T) {
+	s := newTestStream(true)
+	data := []byte{
+		7, 0, 0, 0, // thread id
+		0, 0, 0, 0, // execution time
+		4,    // schema length
+		0, 0, // error code
+		2, 0, // status vars length
+		0xaa, 0xbb, // status vars
+	}
+	data = append(data, "test\x00BEGIN"...)
+	ev, err := s.parseEvent(testEvent(EventQuery, data, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := ev.Data.(*QueryEvent)
+	if q.ThreadID != 7 || q.Schema != "test" || q.Query != "BEGIN" || len(q.StatusVars) != 2 {
+		t.Errorf("unexpected query event: %+v", q)
+	}
+}
+
+func TestParseGTIDEvent(t *testing.T) {
+	s := newTestStream(false)
+	data := []byte{1,
+		0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1,
+		0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62,
+		23, 0, 0, 0, 0, 0, 0, 0,
+	}
+	ev, err := s.parseEvent(testEvent(EventGTID, data, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gtid := ev.Data.(*GTIDEvent).GTID(); gtid != "3e11fa47-71ca-11e1-9e33-c80aa9429562:23" {
+		t.Errorf("unexpected GTID %q", gtid)
+	}
+}
+
+func TestParseEventMalformed(t *testing.T) {
+	s := newTestStream(false)
+	if _, err := s.parseEvent([]byte{1, 2, 3}); err != ErrMalformEvent {
+		t.Errorf("expected ErrMalformEvent for a short header, got %v", err)
+	}
+
+	raw := testEvent(EventXID, []byte{1, 2, 3}, false)
+	if _, err := s.parseEvent(raw); err != ErrMalformEvent {
+		t.Errorf("expected ErrMalformEvent for a short XID event, got %v", err)
+	}
+
+	raw = testEvent(EventXID, make([]byte, 8), false)
+	raw[9]++ // event size
+	if _, err := s.parseEvent(raw); err != ErrMalformEvent {
+		t.Errorf("expected ErrMalformEvent for a wrong event size, got %v", err)
+	}
+}
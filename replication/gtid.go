@@ -0,0 +1,87 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package replication
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// encodeGTIDSet encodes a GTID set like
+// "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,4e11fa47-71ca-11e1-9e33-c80aa9429562:1"
+// for COM_BINLOG_DUMP_GTID.
+//
+// The encoded set consists of the number of SIDs [8 bytes], followed by the
+// SID [16 bytes], the number of intervals [8 bytes] and the intervals
+// [8 bytes start, 8 bytes exclusive end] of each SID.
+func encodeGTIDSet(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+
+	var sids []string
+	if s != "" {
+		sids = strings.Split(s, ",")
+	}
+
+	buf := make([]byte, 8, 8+len(sids)*(16+8+16))
+	binary.LittleEndian.PutUint64(buf, uint64(len(sids)))
+
+	for _, sid := range sids {
+		parts := strings.Split(sid, ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("replication: invalid GTID set %q", sid)
+		}
+
+		uuid, err := hex.DecodeString(strings.Replace(parts[0], "-", "", -1))
+		if err != nil || len(uuid) != 16 {
+			return nil, fmt.Errorf("replication: invalid server UUID %q", parts[0])
+		}
+		buf = append(buf, uuid...)
+
+		intervals := parts[1:]
+		var n [8]byte
+		binary.LittleEndian.PutUint64(n[:], uint64(len(intervals)))
+		buf = append(buf, n[:]...)
+
+		for _, interval := range intervals {
+			start, end, err := parseInterval(interval)
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint64(n[:], uint64(start))
+			buf = append(buf, n[:]...)
+			binary.LittleEndian.PutUint64(n[:], uint64(end+1))
+			buf = append(buf, n[:]...)
+		}
+	}
+	return buf, nil
+}
+
+// parseInterval parses "1-5" or "7"
+func parseInterval(s string) (start, end int64, err error) {
+	bounds := strings.SplitN(s, "-", 2)
+	start, err = strconv.ParseInt(bounds[0], 10, 64)
+	if err == nil {
+		end = start
+		if len(bounds) == 2 {
+			end, err = strconv.ParseInt(bounds[1], 10, 64)
+		}
+	}
+	if err != nil || start < 1 || end < start {
+		return 0, 0, fmt.Errorf("replication: invalid GTID interval %q", s)
+	}
+	return start, end, nil
+}
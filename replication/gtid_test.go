@@ -0,0 +1,52 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package replication
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeGTIDSet(t *testing.T) {
+	enc, err := encodeGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,\n 4e11fa47-71ca-11e1-9e33-c80aa9429562:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		2, 0, 0, 0, 0, 0, 0, 0, // number of SIDs
+		0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1,
+		0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62,
+		2, 0, 0, 0, 0, 0, 0, 0, // number of intervals
+		1, 0, 0, 0, 0, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0, 0,
+		7, 0, 0, 0, 0, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0,
+		0x4e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1,
+		0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62,
+		1, 0, 0, 0, 0, 0, 0, 0,
+		1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0,
+	}
+	if !bytes.Equal(enc, expected) {
+		t.Errorf("unexpected encoded GTID set:\n%v\n%v", enc, expected)
+	}
+
+	if enc, err = encodeGTIDSet(""); err != nil || !bytes.Equal(enc, make([]byte, 8)) {
+		t.Errorf("unexpected encoding of the empty set: %v, %v", enc, err)
+	}
+
+	for _, invalid := range []string{
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562",
+		"3e11fa47:1-5",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:5-1",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:a",
+	} {
+		if _, err = encodeGTIDSet(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,648 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package replication
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types of the binlog
+// https://dev.mysql.com/doc/internals/en/com-query-response.html#column-type
+const (
+	typeDecimal    byte = 0
+	typeTiny       byte = 1
+	typeShort      byte = 2
+	typeLong       byte = 3
+	typeFloat      byte = 4
+	typeDouble     byte = 5
+	typeNULL       byte = 6
+	typeTimestamp  byte = 7
+	typeLongLong   byte = 8
+	typeInt24      byte = 9
+	typeDate       byte = 10
+	typeTime       byte = 11
+	typeDateTime   byte = 12
+	typeYear       byte = 13
+	typeNewDate    byte = 14
+	typeVarChar    byte = 15
+	typeBit        byte = 16
+	typeTimestamp2 byte = 17
+	typeDateTime2  byte = 18
+	typeTime2      byte = 19
+	typeJSON       byte = 245
+	typeNewDecimal byte = 246
+	typeEnum       byte = 247
+	typeSet        byte = 248
+	typeTinyBLOB   byte = 249
+	typeMediumBLOB byte = 250
+	typeLongBLOB   byte = 251
+	typeBLOB       byte = 252
+	typeVarString  byte = 253
+	typeString     byte = 254
+	typeGeometry   byte = 255
+)
+
+// TableMapEvent describes the table of the following rows events.
+type TableMapEvent struct {
+	TableID     uint64
+	Flags       uint16
+	Schema      string
+	Table       string
+	ColumnTypes []byte   // MySQL column types
+	ColumnMeta  []uint16 // Type specific metadata of each column
+	NullBitmap  []byte   // Bit i is set if column i is nullable
+}
+
+// RowsEvent holds the rows changed by a statement.
+//
+// The column values are decoded to
+//   - int64 for integer types (also for unsigned columns, which have to be
+//     converted by the caller, e.g. with uint32(v) for INT UNSIGNED)
+//   - float32 and float64 for FLOAT and DOUBLE
+//   - string for DECIMAL
+//   - time.Time (in UTC) for DATE, DATETIME and TIMESTAMP
+//   - time.Duration for TIME
+//   - uint64 for BIT, ENUM (the index) and SET (the bitmap)
+//   - []byte for strings, BLOBs, GEOMETRY and JSON (MySQL's binary JSON format)
+//
+// NULL values and columns which are not contained in the row image (see
+// binlog_row_image) are nil.
+type RowsEvent struct {
+	Type    EventType
+	TableID uint64
+	Flags   uint16
+	Table   *TableMapEvent
+	Rows    []Row
+}
+
+// Row is a changed row. Before is nil for inserted rows, After is nil for
+// deleted rows.
+type Row struct {
+	Before []interface{}
+	After  []interface{}
+}
+
+// https://dev.mysql.com/doc/internals/en/table-map-event.html
+func parseTableMapEvent(data []byte) (*TableMapEvent, error) {
+	// table id [6 bytes], flags [2 bytes]
+	if len(data) < 8 {
+		return nil, ErrMalformEvent
+	}
+	tm := &TableMapEvent{
+		TableID: readUint48(data),
+		Flags:   binary.LittleEndian.Uint16(data[6:]),
+	}
+	data = data[8:]
+
+	var ok bool
+	// schema name [1 byte length + string + 0x00]
+	if tm.Schema, data, ok = readFixedString(data); !ok {
+		return nil, ErrMalformEvent
+	}
+	// table name [1 byte length + string + 0x00]
+	if tm.Table, data, ok = readFixedString(data); !ok {
+		return nil, ErrMalformEvent
+	}
+
+	// column count [lenenc], column types [column count bytes]
+	count, n := readLengthEncodedInteger(data)
+	if n == 0 || len(data) < n+int(count) {
+		return nil, ErrMalformEvent
+	}
+	data = data[n:]
+	tm.ColumnTypes = data[:count]
+	data = data[count:]
+
+	// metadata [lenenc length + metadata]
+	metaLen, n := readLengthEncodedInteger(data)
+	if n == 0 || len(data) < n+int(metaLen) {
+		return nil, ErrMalformEvent
+	}
+	meta := data[n : n+int(metaLen)]
+	data = data[n+int(metaLen):]
+
+	tm.ColumnMeta = make([]uint16, count)
+	for i, typ := range tm.ColumnTypes {
+		switch typ {
+		case typeFloat, typeDouble, typeBLOB, typeGeometry, typeJSON,
+			typeTimestamp2, typeDateTime2, typeTime2:
+			if len(meta) < 1 {
+				return nil, ErrMalformEvent
+			}
+			tm.ColumnMeta[i] = uint16(meta[0])
+			meta = meta[1:]
+
+		case typeVarChar, typeVarString, typeBit:
+			// max length / bits and bytes
+			if len(meta) < 2 {
+				return nil, ErrMalformEvent
+			}
+			tm.ColumnMeta[i] = binary.LittleEndian.Uint16(meta)
+			meta = meta[2:]
+
+		case typeNewDecimal, typeString, typeEnum, typeSet:
+			// precision and scale / real type and length
+			if len(meta) < 2 {
+				return nil, ErrMalformEvent
+			}
+			tm.ColumnMeta[i] = uint16(meta[0])<<8 | uint16(meta[1])
+			meta = meta[2:]
+		}
+	}
+
+	// NULL-bitmap [(column count + 7) / 8 bytes], optional metadata is ignored
+	if len(data) < (int(count)+7)/8 {
+		return nil, ErrMalformEvent
+	}
+	tm.NullBitmap = data[:(count+7)/8]
+	return tm, nil
+}
+
+// https://dev.mysql.com/doc/internals/en/rows-event.html
+func (s *Stream) parseRowsEvent(typ EventType, data []byte) (*RowsEvent, error) {
+	// table id [6 bytes], flags [2 bytes]
+	if len(data) < 8 {
+		return nil, ErrMalformEvent
+	}
+	ev := &RowsEvent{
+		Type:    typ,
+		TableID: readUint48(data),
+		Flags:   binary.LittleEndian.Uint16(data[6:]),
+	}
+	data = data[8:]
+
+	// version 2: extra data length [2 bytes] including itself, extra data
+	if typ == EventWriteRows || typ == EventUpdateRows || typ == EventDeleteRows {
+		if len(data) < 2 {
+			return nil, ErrMalformEvent
+		}
+		extraLen := int(binary.LittleEndian.Uint16(data))
+		if extraLen < 2 || len(data) < extraLen {
+			return nil, ErrMalformEvent
+		}
+		data = data[extraLen:]
+	}
+
+	tm, ok := s.tables[ev.TableID]
+	if !ok {
+		return nil, fmt.Errorf("replication: no table map for table id %d", ev.TableID)
+	}
+	ev.Table = tm
+
+	// column count [lenenc]
+	count, n := readLengthEncodedInteger(data)
+	if n == 0 || int(count) != len(tm.ColumnTypes) {
+		return nil, ErrMalformEvent
+	}
+	data = data[n:]
+
+	// columns present bitmaps [(column count + 7) / 8 bytes], the second
+	// bitmap for the after image of updates
+	bitmapLen := (int(count) + 7) / 8
+	update := typ == EventUpdateRows || typ == EventUpdateRowsV1
+	need := bitmapLen
+	if update {
+		need *= 2
+	}
+	if len(data) < need {
+		return nil, ErrMalformEvent
+	}
+	present := data[:bitmapLen]
+	presentAfter := present
+	if update {
+		presentAfter = data[bitmapLen : 2*bitmapLen]
+	}
+	data = data[need:]
+
+	for len(data) > 0 {
+		var row Row
+		var err error
+		switch typ {
+		case EventWriteRows, EventWriteRowsV1:
+			row.After, data, err = decodeRow(data, tm, present)
+		case EventDeleteRows, EventDeleteRowsV1:
+			row.Before, data, err = decodeRow(data, tm, present)
+		default:
+			if row.Before, data, err = decodeRow(data, tm, present); err == nil {
+				row.After, data, err = decodeRow(data, tm, presentAfter)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		ev.Rows = append(ev.Rows, row)
+	}
+	return ev, nil
+}
+
+// decodeRow decodes one row image and returns the remaining data
+func decodeRow(data []byte, tm *TableMapEvent, present []byte) ([]interface{}, []byte, error) {
+	presentCount := 0
+	for _, b := range present {
+		presentCount += bits.OnesCount8(b)
+	}
+
+	// NULL-bitmap of the present columns
+	nullLen := (presentCount + 7) / 8
+	if len(data) < nullLen {
+		return nil, nil, ErrMalformEvent
+	}
+	nulls := data[:nullLen]
+	data = data[nullLen:]
+
+	values := make([]interface{}, len(tm.ColumnTypes))
+	nullPos := 0
+	for i, typ := range tm.ColumnTypes {
+		if !isBitSet(present, i) {
+			continue
+		}
+		isNull := isBitSet(nulls, nullPos)
+		nullPos++
+		if isNull {
+			continue
+		}
+
+		v, n, err := decodeValue(typ, tm.ColumnMeta[i], data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("replication: column %d of %s.%s: %v", i, tm.Schema, tm.Table, err)
+		}
+		values[i] = v
+		data = data[n:]
+	}
+	return values, data, nil
+}
+
+// decodeValue decodes a value of the given column type and returns the
+// number of bytes read.
+func decodeValue(typ byte, meta uint16, data []byte) (interface{}, int, error) {
+	// STRING columns hold ENUM and SET, the real type is stored in the meta
+	// data. Lengths > 255 are stored in unused bits of the real type.
+	length := int(meta & 0xff)
+	if typ == typeString && meta >= 256 {
+		realType := byte(meta >> 8)
+		if realType&0x30 != 0x30 {
+			length += int((realType&0x30)^0x30) << 4
+			realType |= 0x30
+		}
+		typ = realType
+	}
+
+	need := 0
+	switch typ {
+	case typeNULL:
+		return nil, 0, nil
+	case typeTiny, typeYear:
+		need = 1
+	case typeShort:
+		need = 2
+	case typeInt24, typeDate:
+		need = 3
+	case typeLong, typeFloat, typeTimestamp:
+		need = 4
+	case typeLongLong, typeDouble, typeDateTime:
+		need = 8
+	case typeTime:
+		need = 3
+	case typeTimestamp2:
+		need = 4 + (int(meta)+1)/2
+	case typeDateTime2:
+		need = 5 + (int(meta)+1)/2
+	case typeTime2:
+		need = 3 + (int(meta)+1)/2
+	case typeBit:
+		need = int(meta>>8) + (int(meta&0xff)+7)/8
+	case typeEnum, typeSet:
+		need = length
+	case typeNewDecimal:
+		need = decimalSize(int(meta>>8), int(meta&0xff))
+	case typeVarChar, typeVarString, typeString:
+		// length [1 or 2 bytes] + data
+		lenSize := 1
+		if (typ == typeString && length > 255) || (typ != typeString && meta > 255) {
+			lenSize = 2
+		}
+		if len(data) < lenSize {
+			return nil, 0, ErrMalformEvent
+		}
+		n := int(data[0])
+		if lenSize == 2 {
+			n = int(binary.LittleEndian.Uint16(data))
+		}
+		need = lenSize + n
+		if len(data) < need {
+			return nil, 0, ErrMalformEvent
+		}
+		return data[lenSize:need], need, nil
+	case typeBLOB, typeGeometry, typeJSON, typeTinyBLOB, typeMediumBLOB, typeLongBLOB:
+		// length [meta bytes] + data
+		lenSize := int(meta)
+		if lenSize < 1 || lenSize > 4 || len(data) < lenSize {
+			return nil, 0, ErrMalformEvent
+		}
+		n := 0
+		for i := 0; i < lenSize; i++ {
+			n |= int(data[i]) << (8 * uint(i))
+		}
+		need = lenSize + n
+		if len(data) < need {
+			return nil, 0, ErrMalformEvent
+		}
+		return data[lenSize:need], need, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported column type %d", typ)
+	}
+
+	if len(data) < need {
+		return nil, 0, ErrMalformEvent
+	}
+	data = data[:need]
+
+	switch typ {
+	case typeTiny:
+		return int64(int8(data[0])), need, nil
+	case typeShort:
+		return int64(int16(binary.LittleEndian.Uint16(data))), need, nil
+	case typeInt24:
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		if v&0x800000 != 0 {
+			v |= 0xff000000
+		}
+		return int64(int32(v)), need, nil
+	case typeLong:
+		return int64(int32(binary.LittleEndian.Uint32(data))), need, nil
+	case typeLongLong:
+		return int64(binary.LittleEndian.Uint64(data)), need, nil
+	case typeFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), need, nil
+	case typeDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), need, nil
+	case typeYear:
+		if data[0] == 0 {
+			return int64(0), need, nil
+		}
+		return int64(data[0]) + 1900, need, nil
+	case typeNewDecimal:
+		return decodeDecimal(data, int(meta>>8), int(meta&0xff)), need, nil
+	case typeBit, typeEnum, typeSet:
+		var v uint64
+		if typ == typeBit {
+			// big endian
+			for _, b := range data {
+				v = v<<8 | uint64(b)
+			}
+		} else {
+			for i, b := range data {
+				v |= uint64(b) << (8 * uint(i))
+			}
+		}
+		return v, need, nil
+	case typeDate:
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		return makeTime(int(v>>9), int(v>>5&15), int(v&31), 0, 0, 0, 0), need, nil
+	case typeTimestamp:
+		sec := int64(binary.LittleEndian.Uint32(data))
+		if sec == 0 {
+			return time.Time{}, need, nil
+		}
+		return time.Unix(sec, 0).UTC(), need, nil
+	case typeTimestamp2:
+		sec := int64(binary.BigEndian.Uint32(data))
+		usec := readFraction(data[4:], int(meta))
+		if sec == 0 && usec == 0 {
+			return time.Time{}, need, nil
+		}
+		return time.Unix(sec, usec*1000).UTC(), need, nil
+	case typeDateTime:
+		// YYYYMMDDhhmmss
+		v := binary.LittleEndian.Uint64(data)
+		d, t := v/1000000, v%1000000
+		return makeTime(int(d/10000), int(d/100%100), int(d%100), int(t/10000), int(t/100%100), int(t%100), 0), need, nil
+	case typeDateTime2:
+		// https://dev.mysql.com/doc/internals/en/date-and-time-data-type-representation.html
+		v := readUint40BE(data) - 0x8000000000
+		ymd := v >> 17
+		ym := ymd >> 5
+		hms := v & (1<<17 - 1)
+		usec := readFraction(data[5:], int(meta))
+		return makeTime(int(ym/13), int(ym%13), int(ymd&31), int(hms>>12), int(hms>>6&63), int(hms&63), usec), need, nil
+	case typeTime:
+		v := int32(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
+		if v&0x800000 != 0 {
+			v -= 1 << 24
+		}
+		neg := v < 0
+		if neg {
+			v = -v
+		}
+		d := time.Duration(v/10000)*time.Hour + time.Duration(v/100%100)*time.Minute + time.Duration(v%100)*time.Second
+		if neg {
+			d = -d
+		}
+		return d, need, nil
+	case typeTime2:
+		return decodeTime2(data, int(meta)), need, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported column type %d", typ)
+}
+
+// makeTime returns the time in UTC, or the zero time for zero dates
+func makeTime(year, month, day, hour, min, sec int, usec int64) time.Time {
+	if year == 0 && month == 0 && day == 0 {
+		return time.Time{}
+	}
+	return time.Date(year, time.Month(month), day, hour, min, sec, int(usec)*1000, time.UTC)
+}
+
+// readFraction reads the fractional seconds of TIMESTAMP2 and DATETIME2 in
+// microseconds, stored in (fsp + 1) / 2 big endian bytes
+func readFraction(data []byte, fsp int) int64 {
+	var v int64
+	for _, b := range data[:(fsp+1)/2] {
+		v = v<<8 | int64(b)
+	}
+	switch (fsp + 1) / 2 {
+	case 1:
+		return v * 10000
+	case 2:
+		return v * 100
+	}
+	return v
+}
+
+// decodeTime2 decodes a TIME2 value, see my_time_packed_from_binary in MySQL
+func decodeTime2(data []byte, fsp int) time.Duration {
+	const intOfs = 0x800000
+	var packed int64
+	switch fsp {
+	case 1, 2:
+		intPart := int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2]) - intOfs
+		frac := int64(int8(data[3]))
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x100
+		}
+		packed = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart := int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2]) - intOfs
+		frac := int64(int16(binary.BigEndian.Uint16(data[3:])))
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		packed = intPart<<24 + frac*100
+	case 5, 6:
+		packed = int64(readUint40BE(data)<<8|uint64(data[5])) - 0x800000000000
+	default:
+		intPart := int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2]) - intOfs
+		packed = intPart << 24
+	}
+
+	neg := packed < 0
+	if neg {
+		packed = -packed
+	}
+	hms := packed >> 24
+	usec := packed % (1 << 24)
+	d := time.Duration(hms>>12&0x3ff)*time.Hour +
+		time.Duration(hms>>6&0x3f)*time.Minute +
+		time.Duration(hms&0x3f)*time.Second +
+		time.Duration(usec)*time.Microsecond
+	if neg {
+		d = -d
+	}
+	return d
+}
+
+// number of bytes used for the leftover digits of a decimal
+var decimalDigitBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decimalSize returns the size of a DECIMAL(precision, scale) value
+func decimalSize(precision, scale int) int {
+	intg := precision - scale
+	return intg/9*4 + decimalDigitBytes[intg%9] + scale/9*4 + decimalDigitBytes[scale%9]
+}
+
+// decodeDecimal decodes a DECIMAL(precision, scale) value, see bin2decimal in
+// MySQL. Groups of 9 digits are stored in 4 big endian bytes, the sign is
+// stored in the highest bit and negative values have all bits inverted.
+func decodeDecimal(data []byte, precision, scale int) string {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+
+	positive := buf[0]&0x80 != 0
+	buf[0] ^= 0x80
+	if !positive {
+		for i := range buf {
+			buf[i] = ^buf[i]
+		}
+	}
+
+	readDigits := func(n int) uint64 {
+		var v uint64
+		for _, b := range buf[:n] {
+			v = v<<8 | uint64(b)
+		}
+		buf = buf[n:]
+		return v
+	}
+
+	var sb strings.Builder
+	if !positive {
+		sb.WriteByte('-')
+	}
+
+	intg := precision - scale
+	var intPart strings.Builder
+	if lead := intg % 9; lead > 0 {
+		intPart.WriteString(strconv.FormatUint(readDigits(decimalDigitBytes[lead]), 10))
+	}
+	for i := 0; i < intg/9; i++ {
+		group := strconv.FormatUint(readDigits(4), 10)
+		if intPart.Len() > 0 {
+			group = strings.Repeat("0", 9-len(group)) + group
+		}
+		intPart.WriteString(group)
+	}
+	digits := strings.TrimLeft(intPart.String(), "0")
+	if digits == "" {
+		digits = "0"
+	}
+	sb.WriteString(digits)
+
+	if scale > 0 {
+		sb.WriteByte('.')
+		for i := 0; i < scale/9; i++ {
+			group := strconv.FormatUint(readDigits(4), 10)
+			sb.WriteString(strings.Repeat("0", 9-len(group)) + group)
+		}
+		if trail := scale % 9; trail > 0 {
+			group := strconv.FormatUint(readDigits(decimalDigitBytes[trail]), 10)
+			sb.WriteString(strings.Repeat("0", trail-len(group)) + group)
+		}
+	}
+	return sb.String()
+}
+
+func isBitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<(uint(i)%8)) != 0
+}
+
+func readUint48(b []byte) uint64 {
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 |
+		uint64(b[3])<<24 | uint64(b[4])<<32 | uint64(b[5])<<40
+}
+
+func readUint40BE(b []byte) uint64 {
+	return uint64(b[0])<<32 | uint64(b[1])<<24 | uint64(b[2])<<16 |
+		uint64(b[3])<<8 | uint64(b[4])
+}
+
+// readFixedString reads a string with a 1 byte length followed by 0x00
+func readFixedString(data []byte) (string, []byte, bool) {
+	if len(data) < 1 {
+		return "", nil, false
+	}
+	n := int(data[0])
+	if len(data) < 1+n+1 {
+		return "", nil, false
+	}
+	return string(data[1 : 1+n]), data[1+n+1:], true
+}
+
+// readLengthEncodedInteger returns the integer and its size, or size 0 if
+// data is too short
+func readLengthEncodedInteger(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	switch data[0] {
+	case 0xfc:
+		if len(data) < 3 {
+			return 0, 0
+		}
+		return uint64(binary.LittleEndian.Uint16(data[1:])), 3
+	case 0xfd:
+		if len(data) < 4 {
+			return 0, 0
+		}
+		return uint64(data[1]) | uint64(data[2])<<8 | uint64(data[3])<<16, 4
+	case 0xfe:
+		if len(data) < 9 {
+			return 0, 0
+		}
+		return binary.LittleEndian.Uint64(data[1:]), 9
+	}
+	return uint64(data[0]), 1
+}
@@ -0,0 +1,171 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package replication
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// table map of
+// CREATE TABLE test.t (id INT NOT NULL, name VARCHAR(50), price DECIMAL(10,2), created DATETIME(3))
+var testTableMap = []byte{
+	0x2a, 0, 0, 0, 0, 0, // table id
+	1, 0, // flags
+	4, 't', 'e', 's', 't', 0, // schema
+	1, 't', 0, // table
+	4,                                                    // column count
+	typeLong, typeVarChar, typeNewDecimal, typeDateTime2, // column types
+	5,      // metadata length
+	200, 0, // VARCHAR(50) in utf8mb4
+	10, 2, // DECIMAL(10,2)
+	3,    // DATETIME(3)
+	0x0e, // NULL-bitmap
+}
+
+func TestParseTableMapEvent(t *testing.T) {
+	s := newTestStream(false)
+	ev, err := s.parseEvent(testEvent(EventTableMap, testTableMap, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := ev.Data.(*TableMapEvent)
+	if tm.TableID != 42 || tm.Schema != "test" || tm.Table != "t" {
+		t.Errorf("unexpected table map: %+v", tm)
+	}
+	if !reflect.DeepEqual(tm.ColumnMeta, []uint16{0, 200, 10<<8 | 2, 3}) {
+		t.Errorf("unexpected column metadata: %v", tm.ColumnMeta)
+	}
+	if s.tables[42] != tm {
+		t.Error("table map was not stored")
+	}
+}
+
+func TestParseRowsEvent(t *testing.T) {
+	s := newTestStream(false)
+	if _, err := s.parseEvent(testEvent(EventTableMap, testTableMap, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	row1 := []byte{
+		0x00,       // NULL-bitmap
+		7, 0, 0, 0, // id
+		3, 'f', 'o', 'o', // name
+		0x80, 0, 0, 12, 34, // price 12.34
+		// 2020-05-07 10:20:30.123
+		0x99, 0xa6, 0x4e, 0xa5, 0x1e, 0x04, 0xce,
+	}
+	row2 := []byte{
+		0x06,                   // NULL-bitmap: name and price are NULL
+		0xff, 0xff, 0xff, 0xff, // id -1
+		0x99, 0xa6, 0x4e, 0xa5, 0x1e, 0x00, 0x00,
+	}
+	created := time.Date(2020, 5, 7, 10, 20, 30, 123000000, time.UTC)
+
+	// WRITE_ROWS v2 with two rows
+	data := []byte{
+		0x2a, 0, 0, 0, 0, 0, // table id
+		1, 0, // flags
+		2, 0, // extra data length
+		4,    // column count
+		0x0f, // columns present
+	}
+	data = append(data, row1...)
+	data = append(data, row2...)
+	ev, err := s.parseEvent(testEvent(EventWriteRows, data, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := ev.Data.(*RowsEvent)
+	expected := []Row{
+		{After: []interface{}{int64(7), []byte("foo"), "12.34", created}},
+		{After: []interface{}{int64(-1), nil, nil, created.Truncate(time.Second)}},
+	}
+	if !reflect.DeepEqual(rows.Rows, expected) {
+		t.Errorf("unexpected rows:\n%v\n%v", rows.Rows, expected)
+	}
+
+	// UPDATE_ROWS v1 with a partial before image
+	data = []byte{
+		0x2a, 0, 0, 0, 0, 0, // table id
+		1, 0, // flags
+		4,                // column count
+		0x01,             // columns present in the before image
+		0x0f,             // columns present in the after image
+		0x00, 7, 0, 0, 0, // before: id
+	}
+	data = append(data, row1...)
+	ev, err = s.parseEvent(testEvent(EventUpdateRowsV1, data, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows = ev.Data.(*RowsEvent)
+	expected = []Row{{
+		Before: []interface{}{int64(7), nil, nil, nil},
+		After:  []interface{}{int64(7), []byte("foo"), "12.34", created},
+	}}
+	if !reflect.DeepEqual(rows.Rows, expected) {
+		t.Errorf("unexpected rows:\n%v\n%v", rows.Rows, expected)
+	}
+
+	// rows of unknown tables cannot be decoded
+	data[0] = 0x2b
+	if _, err = s.parseEvent(testEvent(EventDeleteRowsV1, data, false)); err == nil {
+		t.Error("expected an error for an unknown table")
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		typ      byte
+		meta     uint16
+		data     []byte
+		expected interface{}
+	}{
+		{typeTiny, 0, []byte{0xff}, int64(-1)},
+		{typeShort, 0, []byte{0x39, 0x30}, int64(12345)},
+		{typeInt24, 0, []byte{0xff, 0xff, 0xff}, int64(-1)},
+		{typeLongLong, 0, []byte{1, 0, 0, 0, 0, 0, 0, 0}, int64(1)},
+		{typeDouble, 0, []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}, float64(1)},
+		{typeYear, 0, []byte{120}, int64(2020)},
+		{typeNewDecimal, 10<<8 | 2, []byte{0x7f, 0xff, 0xff, 0xf3, 0xdd}, "-12.34"},
+		{typeNewDecimal, 20<<8 | 0, []byte{0x80, 0, 0, 0, 1, 0, 0, 0, 0}, "1000000000"},
+		{typeDate, 0, []byte{0xa7, 0xc8, 0x0f}, time.Date(2020, 5, 7, 0, 0, 0, 0, time.UTC)},
+		{typeDate, 0, []byte{0, 0, 0}, time.Time{}},
+		{typeTimestamp2, 0, []byte{0x5e, 0xb3, 0xe1, 0xb8}, time.Unix(0x5eb3e1b8, 0).UTC()},
+		{typeTime2, 0, []byte{0x80, 0xa5, 0x1e}, 10*time.Hour + 20*time.Minute + 30*time.Second},
+		{typeTime2, 0, []byte{0x7f, 0x5a, 0xe2}, -(10*time.Hour + 20*time.Minute + 30*time.Second)},
+		{typeBit, 2 << 8, []byte{0x01, 0x02}, uint64(0x0102)},
+		{typeString, uint16(typeEnum)<<8 | 1, []byte{2}, uint64(2)},
+		{typeString, uint16(typeSet)<<8 | 2, []byte{5, 0}, uint64(5)},
+		{typeString, uint16(typeString)<<8 | 10, []byte{2, 'h', 'i'}, []byte("hi")},
+		// CHAR(255) in utf8mb4, the length is stored in the real type
+		{typeString, uint16(typeString&^0x10)<<8 | (1020 & 0xff), []byte{2, 0, 'h', 'i'}, []byte("hi")},
+		{typeVarChar, 1000, []byte{2, 0, 'h', 'i'}, []byte("hi")},
+		{typeBLOB, 2, []byte{2, 0, 'h', 'i'}, []byte("hi")},
+	}
+	for _, tt := range tests {
+		v, n, err := decodeValue(tt.typ, tt.meta, tt.data)
+		if err != nil {
+			t.Errorf("type %d: %v", tt.typ, err)
+			continue
+		}
+		if n != len(tt.data) {
+			t.Errorf("type %d: expected to read %d bytes, read %d", tt.typ, len(tt.data), n)
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("type %d: expected %#v, got %#v", tt.typ, tt.expected, v)
+		}
+	}
+
+	if _, _, err := decodeValue(typeLong, 0, []byte{1, 2}); err != ErrMalformEvent {
+		t.Errorf("expected ErrMalformEvent for short data, got %v", err)
+	}
+}
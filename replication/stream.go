@@ -0,0 +1,235 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package replication implements a binlog replication client on top of the
+// connections of the MySQL driver. It registers as a replica, requests the
+// binlog with COM_BINLOG_DUMP or COM_BINLOG_DUMP_GTID and decodes the events,
+// e.g. for change data capture:
+//
+//	cfg, err := mysql.ParseDSN("repl:password@tcp(db:3306)/")
+//	...
+//	stream, err := replication.StartGTID(ctx, cfg, replication.Config{ServerID: 1001}, gtidSet)
+//	...
+//	for {
+//		ev, err := stream.Next()
+//		...
+//		if rows, ok := ev.Data.(*replication.RowsEvent); ok {
+//			...
+//		}
+//	}
+//
+// The user needs the REPLICATION SLAVE privilege. MySQL 5.6+ with row based
+// logging (binlog_format=ROW) is supported.
+package replication
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// binlogConn is implemented by the connections of the mysql package
+type binlogConn interface {
+	driver.Conn
+	driver.ExecerContext
+	driver.QueryerContext
+	RegisterReplica(serverID uint32, host, user, password string, port uint16) error
+	DumpBinlog(serverID uint32, flags uint16, file string, pos uint32) error
+	DumpBinlogGTID(serverID uint32, flags uint16, file string, pos uint64, gtidSet []byte) error
+	ReadBinlogEvent() ([]byte, error)
+}
+
+// flags of COM_BINLOG_DUMP and COM_BINLOG_DUMP_GTID
+const (
+	binlogDumpNonBlock uint16 = 0x01
+	binlogThroughGTID  uint16 = 0x04
+)
+
+// Config configures a binlog stream.
+type Config struct {
+	ServerID        uint32        // Server id of the replica, must be unique among all servers and replicas
+	ReportHost      string        // Host name reported to the source, shown by SHOW REPLICAS
+	ReportPort      uint16        // Port reported to the source, shown by SHOW REPLICAS
+	NonBlocking     bool          // End the stream with io.EOF at the end of the binlog instead of waiting for new events
+	HeartbeatPeriod time.Duration // Make the source send heartbeat events when it has no events to send
+}
+
+// Stream is a stream of binlog events.
+// It is not safe for concurrent use.
+type Stream struct {
+	conn     binlogConn
+	checksum bool // events end with a CRC32 checksum
+	tables   map[uint64]*TableMapEvent
+	file     string
+	pos      uint32
+}
+
+// StartFile starts streaming the binlog events of the given binlog file,
+// starting at pos. Use pos 4 to start at the beginning of the file.
+func StartFile(ctx context.Context, cfg *mysql.Config, rcfg Config, file string, pos uint32) (*Stream, error) {
+	s, err := connect(ctx, cfg, rcfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags uint16
+	if rcfg.NonBlocking {
+		flags |= binlogDumpNonBlock
+	}
+	if err = s.conn.DumpBinlog(rcfg.ServerID, flags, file, pos); err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.file, s.pos = file, pos
+	return s, nil
+}
+
+// StartGTID starts streaming the binlog events of all transactions which are
+// not contained in gtidSet, e.g. "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5".
+// The source must use gtid_mode=ON.
+func StartGTID(ctx context.Context, cfg *mysql.Config, rcfg Config, gtidSet string) (*Stream, error) {
+	gtids, err := encodeGTIDSet(gtidSet)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := connect(ctx, cfg, rcfg)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := binlogThroughGTID
+	if rcfg.NonBlocking {
+		flags |= binlogDumpNonBlock
+	}
+	if err = s.conn.DumpBinlogGTID(rcfg.ServerID, flags, "", 4, gtids); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect opens the connection and registers it as a replica
+func connect(ctx context.Context, cfg *mysql.Config, rcfg Config) (*Stream, error) {
+	if rcfg.ServerID == 0 {
+		return nil, errors.New("replication: server id must not be 0")
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c, err := connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := c.(binlogConn)
+	if !ok {
+		c.Close()
+		return nil, errors.New("replication: connection does not support replication")
+	}
+
+	s := &Stream{
+		conn:   conn,
+		tables: make(map[uint64]*TableMapEvent),
+	}
+	if err = s.setup(ctx, rcfg); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Stream) setup(ctx context.Context, rcfg Config) error {
+	// Tell the source we can verify checksums, otherwise it refuses to send
+	// events with checksums.
+	checksum, err := s.queryString(ctx, "SELECT @@global.binlog_checksum")
+	if err != nil {
+		return err
+	}
+	if checksum != "NONE" {
+		if _, err = s.conn.ExecContext(ctx, "SET @master_binlog_checksum = @@global.binlog_checksum", nil); err != nil {
+			return err
+		}
+		s.checksum = true
+	}
+
+	if rcfg.HeartbeatPeriod > 0 {
+		period := strconv.FormatInt(int64(rcfg.HeartbeatPeriod), 10)
+		if _, err = s.conn.ExecContext(ctx, "SET @master_heartbeat_period = "+period, nil); err != nil {
+			return err
+		}
+	}
+
+	return s.conn.RegisterReplica(rcfg.ServerID, rcfg.ReportHost, "", "", rcfg.ReportPort)
+}
+
+// queryString returns the first column of the first row of the query result
+func (s *Stream) queryString(ctx context.Context, query string) (string, error) {
+	rows, err := s.conn.QueryContext(ctx, query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	if err = rows.Next(dest); err != nil {
+		if err == io.EOF {
+			err = errors.New("replication: empty result for " + query)
+		}
+		return "", err
+	}
+	switch v := dest[0].(type) {
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	}
+	return "", nil
+}
+
+// Next returns the next event. It blocks until the source sends an event,
+// unless Config.NonBlocking was set; then it returns io.EOF at the end of
+// the binlog.
+func (s *Stream) Next() (*Event, error) {
+	data, err := s.conn.ReadBinlogEvent()
+	if err != nil {
+		return nil, err
+	}
+
+	// the data is only valid until the next read
+	raw := make([]byte, len(data))
+	copy(raw, data)
+
+	ev, err := s.parseEvent(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if rotate, ok := ev.Data.(*RotateEvent); ok {
+		s.file, s.pos = rotate.NextFile, uint32(rotate.Position)
+	} else if ev.Header.LogPos > 0 {
+		s.pos = ev.Header.LogPos
+	}
+	return ev, nil
+}
+
+// Position returns the binlog file and the position after the last event.
+func (s *Stream) Position() (string, uint32) {
+	return s.file, s.pos
+}
+
+// Close closes the connection.
+func (s *Stream) Close() error {
+	return s.conn.Close()
+}
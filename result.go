@@ -8,9 +8,32 @@
 
 package mysql
 
+// WarningsResult is implemented by the driver.Result and driver.Rows of the
+// driver. database/sql wraps them, so they can only be reached by calling the
+// driver connection inside sql.Conn.Raw:
+//
+//	err = conn.Raw(func(driverConn interface{}) error {
+//		res, err := driverConn.(driver.ExecerContext).ExecContext(ctx, query, nil)
+//		if err != nil {
+//			return err
+//		}
+//		warnings := res.(mysql.WarningsResult).Warnings()
+//		...
+//	})
+type WarningsResult interface {
+	// WarningCount returns the number of warnings the statement caused.
+	WarningCount() uint16
+
+	// Warnings returns the warnings the statement caused. They are only
+	// fetched if fetchWarnings or warningsAsErrors is set.
+	Warnings() MySQLWarnings
+}
+
 type mysqlResult struct {
 	affectedRows int64
 	insertId     int64
+	warningCount uint16
+	warnings     MySQLWarnings
 }
 
 func (res *mysqlResult) LastInsertId() (int64, error) {
@@ -20,3 +43,14 @@ func (res *mysqlResult) LastInsertId() (int64, error) {
 func (res *mysqlResult) RowsAffected() (int64, error) {
 	return res.affectedRows, nil
 }
+
+// WarningCount returns the number of warnings the statement caused.
+func (res *mysqlResult) WarningCount() uint16 {
+	return res.warningCount
+}
+
+// Warnings returns the warnings the statement caused. They are only fetched
+// if fetchWarnings or warningsAsErrors is set.
+func (res *mysqlResult) Warnings() MySQLWarnings {
+	return res.warnings
+}
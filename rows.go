@@ -9,6 +9,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql/driver"
 	"io"
 	"math"
@@ -19,16 +20,33 @@ type resultSet struct {
 	columns     []mysqlField
 	columnNames []string
 	done        bool
+
+	// trailer of the packet terminating the result set
+	warnings uint16
+	info     string
+}
+
+// setTrailer stores the trailer of the packet which terminated the result set
+func (rs *resultSet) setTrailer(mc *mysqlConn) {
+	rs.warnings = mc.warnings
+	rs.info = mc.info
 }
 
 type mysqlRows struct {
-	mc     *mysqlConn
-	rs     resultSet
-	finish func()
+	mc       *mysqlConn
+	rs       resultSet
+	finish   func()
+	warnings MySQLWarnings // warnings of the last result set, if fetched
 }
 
 type binaryRows struct {
 	mysqlRows
+
+	// set if the rows are fetched from a server-side cursor
+	stmt      *mysqlStmt
+	ctx       context.Context
+	fetchSize int
+	fetched   [][]byte // rows already read from the network but not returned yet
 }
 
 type textRows struct {
@@ -97,6 +115,39 @@ func (rows *mysqlRows) ColumnTypeScanType(i int) reflect.Type {
 	return rows.rs.columns[i].scanType()
 }
 
+// WarningCount returns the number of warnings of the current result set.
+// It is only known after all rows of the result set were read.
+func (rows *mysqlRows) WarningCount() uint16 {
+	return rows.rs.warnings
+}
+
+// Warnings returns the warnings of the last result set. They are only fetched
+// if fetchWarnings or warningsAsErrors is set, after all rows were read.
+func (rows *mysqlRows) Warnings() MySQLWarnings {
+	return rows.warnings
+}
+
+// handleEOF handles the packet terminating the current result set.
+// It returns io.EOF if the result set was terminated successfully.
+func (rows *mysqlRows) handleEOF(data []byte) error {
+	mc := rows.mc
+	if err := mc.handleEOFPacket(data); err != nil {
+		return err
+	}
+	rows.rs.setTrailer(mc)
+	rows.rs.done = true
+	if !rows.HasNextResultSet() {
+		rows.mc = nil
+
+		// the connection is idle again and warnings can be fetched
+		var err error
+		if rows.warnings, err = mc.fetchWarnings(); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
 func (rows *mysqlRows) Close() (err error) {
 	if f := rows.finish; f != nil {
 		f()
@@ -194,6 +245,11 @@ func (rows *binaryRows) Next(dest []driver.Value) error {
 			return err
 		}
 
+		// Fetch next row from cursor
+		if rows.stmt != nil || len(rows.fetched) > 0 {
+			return rows.fetchRow(dest)
+		}
+
 		// Fetch next row from stream
 		return rows.readRow(dest)
 	}
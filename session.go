@@ -0,0 +1,118 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+// Types of session state changes
+// https://dev.mysql.com/doc/internals/en/packet-OK_Packet.html#cs-sect-packet-ok-sessioninfo
+const (
+	sessionTrackSystemVariables byte = iota
+	sessionTrackSchema
+	sessionTrackStateChange
+	sessionTrackGTIDs
+	sessionTrackTransactionCharacteristics
+	sessionTrackTransactionState
+)
+
+// SessionState holds the session state changes the server reported with an
+// OK packet. Which changes are reported is controlled by the session_track_*
+// system variables of the server, e.g. session_track_gtids=OWN_GTID.
+type SessionState struct {
+	SystemVariables            map[string]string // Changed system variables
+	Schema                     string            // New default schema, empty if unchanged
+	StateChanged               bool              // Set if any session state changed
+	GTIDs                      string            // GTIDs of the last committed transaction
+	TransactionCharacteristics string            // Statements to restore the transaction characteristics
+	TransactionState           string            // Transaction state, see session_track_transaction_info
+}
+
+// parse parses the session state information of an OK packet
+func (st *SessionState) parse(data []byte) error {
+	for len(data) > 0 {
+		// type [1 byte]
+		typ := data[0]
+
+		// data [length encoded string]
+		entry, _, n, err := readLengthEncodedString(data[1:])
+		if err != nil {
+			return ErrMalformPkt
+		}
+		data = data[1+n:]
+
+		switch typ {
+		case sessionTrackSystemVariables:
+			// name [length encoded string]
+			name, _, n, err := readLengthEncodedString(entry)
+			if err != nil {
+				return ErrMalformPkt
+			}
+			// value [length encoded string]
+			value, _, _, err := readLengthEncodedString(entry[n:])
+			if err != nil {
+				return ErrMalformPkt
+			}
+			if st.SystemVariables == nil {
+				st.SystemVariables = make(map[string]string)
+			}
+			st.SystemVariables[string(name)] = string(value)
+
+		case sessionTrackSchema:
+			schema, _, _, err := readLengthEncodedString(entry)
+			if err != nil {
+				return ErrMalformPkt
+			}
+			st.Schema = string(schema)
+
+		case sessionTrackStateChange:
+			changed, _, _, err := readLengthEncodedString(entry)
+			if err != nil {
+				return ErrMalformPkt
+			}
+			st.StateChanged = string(changed) == "1"
+
+		case sessionTrackGTIDs:
+			// encoding specification [1 byte], only 0 is defined
+			if len(entry) == 0 || entry[0] != 0 {
+				continue
+			}
+			gtids, _, _, err := readLengthEncodedString(entry[1:])
+			if err != nil {
+				return ErrMalformPkt
+			}
+			st.GTIDs = string(gtids)
+
+		case sessionTrackTransactionCharacteristics:
+			chars, _, _, err := readLengthEncodedString(entry)
+			if err != nil {
+				return ErrMalformPkt
+			}
+			st.TransactionCharacteristics = string(chars)
+
+		case sessionTrackTransactionState:
+			state, _, _, err := readLengthEncodedString(entry)
+			if err != nil {
+				return ErrMalformPkt
+			}
+			st.TransactionState = string(state)
+		}
+		// unknown types are skipped
+	}
+	return nil
+}
+
+// SessionState returns the session state changes the server reported with the
+// last OK packet. It can be accessed through sql.Conn.Raw:
+//
+//	err := conn.Raw(func(driverConn interface{}) error {
+//		type sessionStater interface{ SessionState() mysql.SessionState }
+//		gtids = driverConn.(sessionStater).SessionState().GTIDs
+//		return nil
+//	})
+func (mc *mysqlConn) SessionState() SessionState {
+	return mc.session
+}
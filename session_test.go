@@ -0,0 +1,75 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOkPacketSessionState(t *testing.T) {
+	_, mc := newRWMockConn(1)
+	mc.flags = clientSessionTrack
+
+	gtid := "3e11fa47-71ca-11e1-9e33-c80aa9429562:23"
+	changes := []byte{
+		// system variable autocommit = OFF
+		sessionTrackSystemVariables, 15, 10, 'a', 'u', 't', 'o', 'c', 'o', 'm', 'm', 'i', 't', 3, 'O', 'F', 'F',
+		// schema gotest
+		sessionTrackSchema, 7, 6, 'g', 'o', 't', 'e', 's', 't',
+		// state changed
+		sessionTrackStateChange, 2, 1, '1',
+		// unknown type
+		0x42, 1, 0,
+	}
+	changes = append(changes, sessionTrackGTIDs, byte(2+len(gtid)), 0, byte(len(gtid)))
+	changes = append(changes, gtid...)
+
+	// affected rows 1, insert id 0, status SERVER_SESSION_STATE_CHANGED |
+	// SERVER_STATUS_AUTOCOMMIT, no warnings, info, session state info
+	data := []byte{iOK, 1, 0, 0x02, 0x40, 0, 0, 3, 'f', 'o', 'o', byte(len(changes))}
+	data = append(data, changes...)
+
+	if err := mc.handleOkPacket(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if mc.affectedRows != 1 || mc.info != "foo" {
+		t.Errorf("unexpected OK packet contents: affected rows %d, info %q", mc.affectedRows, mc.info)
+	}
+
+	expected := SessionState{
+		SystemVariables: map[string]string{"autocommit": "OFF"},
+		Schema:          "gotest",
+		StateChanged:    true,
+		GTIDs:           gtid,
+	}
+	if st := mc.SessionState(); !reflect.DeepEqual(st, expected) {
+		t.Errorf("unexpected session state:\ngot  %+v\nwant %+v", st, expected)
+	}
+
+	// the next OK packet without changes resets the session state
+	if err := mc.handleOkPacket([]byte{iOK, 0, 0, 0x02, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if st := mc.SessionState(); !reflect.DeepEqual(st, SessionState{}) {
+		t.Errorf("session state was not reset: %+v", st)
+	}
+}
+
+func TestOkPacketSessionStateMalformed(t *testing.T) {
+	_, mc := newRWMockConn(1)
+	mc.flags = clientSessionTrack
+
+	// session state info is longer than the packet
+	data := []byte{iOK, 0, 0, 0x02, 0x40, 0, 0, 0, 10, sessionTrackSchema, 7}
+	if err := mc.handleOkPacket(data); err != ErrMalformPkt {
+		t.Errorf("expected ErrMalformPkt, got %v", err)
+	}
+}
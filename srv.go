@@ -0,0 +1,53 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// netSRV is the network of addresses which are the name of SRV records,
+// e.g. tcp+srv(_mysql._tcp.db.internal)
+const netSRV = "tcp+srv"
+
+// lookupSRV resolves SRV records, replaced by tests.
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+// dialSRV resolves the SRV records of the address and dials their targets
+// until one accepts the connection. The records are ordered by priority and
+// randomized by weight by the resolver. It returns the config for the
+// target.
+func dialSRV(ctx context.Context, cfg *Config) (net.Conn, *Config, error) {
+	_, srvs, err := lookupSRV(ctx, "", "", cfg.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(srvs) == 0 {
+		return nil, nil, errors.New("no SRV records for " + cfg.Addr)
+	}
+
+	for _, srv := range srvs {
+		addr := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+		targetCfg := cfg.forHost(addr)
+		targetCfg.Net = "tcp"
+
+		var conn net.Conn
+		if conn, err = dial(ctx, targetCfg, addr); err == nil {
+			return conn, targetCfg, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, nil, err
+}
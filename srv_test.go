@@ -0,0 +1,82 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestConnectorSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "db1.internal.", Port: 3306, Priority: 10},
+		{Target: "db2.internal.", Port: 3307, Priority: 20},
+	}
+	lookups := 0
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		lookups++
+		if name != "_mysql._tcp.db.internal" {
+			t.Errorf("unexpected name %q", name)
+		}
+		return name, records, nil
+	}
+	defer func() { lookupSRV = net.DefaultResolver.LookupSRV }()
+
+	var dialed []string
+	dialsLock.Lock()
+	tcpDial, hasTCPDial := dials["tcp"]
+	dials["tcp"] = func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if addr == "db1.internal:3306" {
+			return nil, errors.New("connection refused")
+		}
+		return newHandshakeMockConn(), nil
+	}
+	dialsLock.Unlock()
+	defer func() {
+		dialsLock.Lock()
+		if hasTCPDial {
+			dials["tcp"] = tcpDial
+		} else {
+			delete(dials, "tcp")
+		}
+		dialsLock.Unlock()
+	}()
+
+	cfg, err := ParseDSN("tcp+srv(_mysql._tcp.db.internal)/dbname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConnector(cfg)
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mc := conn.(*mysqlConn); mc.cfg.Net != "tcp" || mc.cfg.Addr != "db2.internal:3307" {
+		t.Errorf("unexpected target %s(%s)", mc.cfg.Net, mc.cfg.Addr)
+	}
+	conn.Close()
+	if !reflect.DeepEqual(dialed, []string{"db1.internal:3306", "db2.internal:3307"}) {
+		t.Errorf("targets were not dialed by priority: %v", dialed)
+	}
+
+	// the records are resolved again for every connection
+	records = records[1:]
+	dialed = nil
+	if conn, err = c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if lookups != 2 || !reflect.DeepEqual(dialed, []string{"db2.internal:3307"}) {
+		t.Errorf("records were not resolved again: %d lookups, dialed %v", lookups, dialed)
+	}
+}
@@ -56,7 +56,7 @@ func (stmt *mysqlStmt) Exec(args []driver.Value) (driver.Result, error) {
 		return nil, driver.ErrBadConn
 	}
 	// Send command
-	err := stmt.writeExecutePacket(args)
+	err := stmt.writeExecutePacket(args, cursorTypeNoCursor)
 	if err != nil {
 		return nil, stmt.mc.markBadConn(err)
 	}
@@ -74,7 +74,7 @@ func (stmt *mysqlStmt) Exec(args []driver.Value) (driver.Result, error) {
 
 	if resLen > 0 {
 		// Columns
-		if err = mc.readUntilEOF(); err != nil {
+		if err = mc.skipColumns(resLen); err != nil {
 			return nil, err
 		}
 
@@ -88,10 +88,13 @@ func (stmt *mysqlStmt) Exec(args []driver.Value) (driver.Result, error) {
 		return nil, err
 	}
 
-	return &mysqlResult{
+	res := &mysqlResult{
 		affectedRows: int64(mc.affectedRows),
 		insertId:     int64(mc.insertId),
-	}, nil
+		warningCount: mc.warnings,
+	}
+	res.warnings, err = mc.fetchWarnings()
+	return res, err
 }
 
 func (stmt *mysqlStmt) Query(args []driver.Value) (driver.Rows, error) {
@@ -104,7 +107,7 @@ func (stmt *mysqlStmt) query(args []driver.Value) (*binaryRows, error) {
 		return nil, driver.ErrBadConn
 	}
 	// Send command
-	err := stmt.writeExecutePacket(args)
+	err := stmt.writeExecutePacket(args, cursorTypeNoCursor)
 	if err != nil {
 		return nil, stmt.mc.markBadConn(err)
 	}
@@ -141,10 +144,11 @@ var jsonType = reflect.TypeOf(json.RawMessage{})
 type converter struct{}
 
 // ConvertValue mirrors the reference/default converter in database/sql/driver
-// with _one_ exception.  We support uint64 with their high bit and the default
-// implementation does not.  This function should be kept in sync with
-// database/sql/driver defaultConverter.ConvertValue() except for that
-// deliberate difference.
+// with _two_ exceptions.  We support uint64 with their high bit and the default
+// implementation does not.  And io.Reader values are passed through, they are
+// streamed to the server when the statement is executed.  This function should
+// be kept in sync with database/sql/driver defaultConverter.ConvertValue()
+// except for those deliberate differences.
 func (c converter) ConvertValue(v interface{}) (driver.Value, error) {
 	if driver.IsValue(v) {
 		return v, nil
@@ -160,6 +164,12 @@ func (c converter) ConvertValue(v interface{}) (driver.Value, error) {
 		}
 		return sv, nil
 	}
+
+	// Readers are streamed with COM_STMT_SEND_LONG_DATA
+	if r, ok := v.(io.Reader); ok {
+		return r, nil
+	}
+
 	rv := reflect.ValueOf(v)
 	switch rv.Kind() {
 	case reflect.Ptr:
@@ -10,7 +10,11 @@ package mysql
 
 import (
 	"bytes"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -139,3 +143,103 @@ func TestConvertJSON(t *testing.T) {
 		t.Fatalf("json.RawMessage converted, got %#v %T", out, out)
 	}
 }
+
+func TestConvertReader(t *testing.T) {
+	r := strings.NewReader("gopher")
+
+	out, err := converter{}.ConvertValue(r)
+	if err != nil {
+		t.Fatal("io.Reader was failed in convert", err)
+	}
+	if out != r {
+		t.Fatalf("io.Reader converted, got %#v %T", out, out)
+	}
+}
+
+// longDataPackets splits the COM_STMT_SEND_LONG_DATA packets from the written
+// bytes and returns their values. The remaining bytes are returned as rest.
+func longDataPackets(t *testing.T, written []byte) (values [][]byte, rest []byte) {
+	for len(written) > 4 && written[4] == comStmtSendLongData {
+		pktLen := int(uint32(written[0]) | uint32(written[1])<<8 | uint32(written[2])<<16)
+		if written[3] != 0 {
+			t.Errorf("wrong sequence of long data packet: %d", written[3])
+		}
+		values = append(values, written[4+7:4+pktLen])
+		written = written[4+pktLen:]
+	}
+	return values, written
+}
+
+func TestWriteExecutePacketReader(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	mc.maxAllowedPacket = 1 + 7 + 10 // 10 bytes of data per packet
+	stmt := &mysqlStmt{mc: mc, id: 1, paramCount: 2}
+
+	value := strings.Repeat("gopher", 4)
+	args := []driver.Value{strings.NewReader(value), strings.NewReader("")}
+	if err := stmt.writeExecutePacket(args, cursorTypeNoCursor); err != nil {
+		t.Fatal(err)
+	}
+
+	values, rest := longDataPackets(t, conn.written)
+	if len(values) != 4 {
+		t.Fatalf("expected 4 long data packets, got %d", len(values))
+	}
+	if got := string(bytes.Join(values[:3], nil)); got != value {
+		t.Errorf("wrong streamed value: %q", got)
+	}
+	if len(values[3]) != 0 {
+		t.Errorf("expected empty value, got %q", values[3])
+	}
+
+	// the execute packet has no values
+	if len(rest) < 5 || rest[4] != comStmtExecute {
+		t.Fatalf("expected execute packet, got %v", rest)
+	}
+	if pktLen := int(rest[0]); pktLen != 1+4+1+4+1+1+2*2 {
+		t.Errorf("unexpected execute packet length: %d", pktLen)
+	}
+}
+
+func TestWriteExecutePacketReaderChunks(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	stmt := &mysqlStmt{mc: mc, id: 1, paramCount: 1}
+
+	// large values are sent in chunks instead of packets of max_allowed_packet
+	value := strings.Repeat("gopher", 10000)
+	args := []driver.Value{strings.NewReader(value)}
+	if err := stmt.writeExecutePacket(args, cursorTypeNoCursor); err != nil {
+		t.Fatal(err)
+	}
+
+	values, _ := longDataPackets(t, conn.written)
+	if len(values) != 4 {
+		t.Fatalf("expected 4 long data packets, got %d", len(values))
+	}
+	if got := string(bytes.Join(values, nil)); got != value {
+		t.Errorf("wrong streamed value of length %d", len(got))
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestWriteExecutePacketReaderError(t *testing.T) {
+	conn, mc := newRWMockConn(0)
+	// reply to COM_STMT_RESET
+	conn.data = []byte{7, 0, 0, 1, iOK, 0, 0, 2, 0, 0, 0}
+	stmt := &mysqlStmt{mc: mc, id: 1, paramCount: 1}
+
+	args := []driver.Value{io.MultiReader(strings.NewReader("gopher"), failingReader{})}
+	err := stmt.writeExecutePacket(args, cursorTypeNoCursor)
+	if err == nil || err.Error() != "read failed" {
+		t.Fatalf("expected read error, got %v", err)
+	}
+
+	if len(conn.written) != 9 || conn.written[4] != comStmtReset {
+		t.Errorf("expected COM_STMT_RESET, got %v", conn.written)
+	}
+}
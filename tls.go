@@ -0,0 +1,184 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values of the ssl-mode DSN parameter
+const (
+	sslModeDisabled       = "DISABLED"
+	sslModePreferred      = "PREFERRED"
+	sslModeRequired       = "REQUIRED"
+	sslModeVerifyCA       = "VERIFY_CA"
+	sslModeVerifyIdentity = "VERIFY_IDENTITY"
+)
+
+// tlsVersions maps the lowercased values of tls-min-version to the versions
+// of crypto/tls. tls.VersionTLS13 needs Go 1.12, which the go 1.20 directive
+// of go.mod already requires.
+var tlsVersions = map[string]uint16{
+	"tls1.0": tls.VersionTLS10,
+	"tls1.1": tls.VersionTLS11,
+	"tls1.2": tls.VersionTLS12,
+	"tls1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses TLS versions like "TLS1.2"
+func parseTLSVersion(version string) (uint16, error) {
+	if v, ok := tlsVersions[strings.ToLower(version)]; ok {
+		return v, nil
+	}
+	return 0, errors.New("invalid TLS version: " + version)
+}
+
+// tlsFiles loads the CA and client certificate given by the tls-ca, tls-cert
+// and tls-key DSN parameters. The files are read again when they are
+// modified, so that rotated certificates are used by new connections.
+type tlsFiles struct {
+	ca, cert, key string
+
+	mu       sync.Mutex
+	modTimes [3]time.Time
+	rootCAs  *x509.CertPool
+	certs    []tls.Certificate
+}
+
+func newTLSFiles(ca, cert, key string) (*tlsFiles, error) {
+	if (cert == "") != (key == "") {
+		return nil, errors.New("tls-cert and tls-key must be set together")
+	}
+	f := &tlsFiles{ca: ca, cert: cert, key: key}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload reads the files again if any of them was modified since the last
+// call. The caller must hold f.mu, except during construction.
+func (f *tlsFiles) reload() error {
+	var modTimes [3]time.Time
+	for i, name := range []string{f.ca, f.cert, f.key} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	if modTimes == f.modTimes {
+		return nil
+	}
+
+	var rootCAs *x509.CertPool
+	if f.ca != "" {
+		pem, err := ioutil.ReadFile(f.ca)
+		if err != nil {
+			return err
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return errors.New("no valid certificates in " + f.ca)
+		}
+	}
+
+	var certs []tls.Certificate
+	if f.cert != "" {
+		cert, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return err
+		}
+		certs = []tls.Certificate{cert}
+	}
+
+	f.rootCAs, f.certs, f.modTimes = rootCAs, certs, modTimes
+	return nil
+}
+
+// apply sets the current certificates in the given TLS config.
+func (f *tlsFiles) apply(cfg *tls.Config) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reload(); err != nil {
+		return err
+	}
+	if f.rootCAs != nil {
+		cfg.RootCAs = f.rootCAs
+	}
+	if f.certs != nil {
+		cfg.Certificates = f.certs
+	}
+	return nil
+}
+
+// tlsPreferred reports whether connections fall back to plaintext if the
+// server does not support TLS.
+func (cfg *Config) tlsPreferred() bool {
+	return cfg.TLSConfig == "preferred" || cfg.SSLMode == sslModePreferred
+}
+
+// tlsConfig returns the TLS config for a new connection.
+func (cfg *Config) tlsConfig() (*tls.Config, error) {
+	if cfg.tlsFiles == nil && cfg.SSLMode != sslModeVerifyCA {
+		return cfg.tls, nil
+	}
+	tlsCfg := cfg.tls.Clone()
+	if cfg.tlsFiles != nil {
+		if err := cfg.tlsFiles.apply(tlsCfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SSLMode == sslModeVerifyCA {
+		// crypto/tls always checks the host name, so the chain is verified
+		// by the callback instead
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyPeerCertificate = verifyCertChain(tlsCfg.RootCAs)
+	}
+	return tlsCfg, nil
+}
+
+// verifyCertChain returns a callback for tls.Config.VerifyPeerCertificate
+// which verifies the certificate chain of the server against roots, but not
+// the host name.
+func verifyCertChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server did not send a certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
@@ -0,0 +1,225 @@
+// Go MySQL Driver - A MySQL-Driver for Go's database/sql package
+//
+// Copyright 2020 The Go-MySQL-Driver Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mysql
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and its key to dir
+func writeTestCert(t *testing.T, dir, name string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: der},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for file, block := range files {
+		path := filepath.Join(dir, file)
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDSNTLSFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysql-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	modTime := time.Now().Add(-time.Minute)
+	writeTestCert(t, dir, "first", modTime)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	dsn := "tcp(example.com:3306)/?tls-ca=" + url.QueryEscape(certFile) +
+		"&tls-cert=" + url.QueryEscape(certFile) + "&tls-key=" + url.QueryEscape(keyFile) +
+		"&tls-min-version=TLS1.3"
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLSCA != certFile || cfg.TLSCert != certFile || cfg.TLSKey != keyFile {
+		t.Errorf("unexpected files: %q %q %q", cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+	}
+	if cfg.FormatDSN() != dsn {
+		t.Errorf("FormatDSN: expected %q, got %q", dsn, cfg.FormatDSN())
+	}
+
+	commonName := func(tlsCfg *tls.Config) string {
+		cert, err := x509.ParseCertificate(tlsCfg.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Subject.CommonName
+	}
+
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.RootCAs == nil || len(tlsCfg.Certificates) != 1 {
+		t.Fatal("the certificates were not loaded")
+	}
+	if tlsCfg.MinVersion != tls.VersionTLS13 || tlsCfg.ServerName != "example.com" {
+		t.Errorf("unexpected TLS config: version %x, server name %q", tlsCfg.MinVersion, tlsCfg.ServerName)
+	}
+	if name := commonName(tlsCfg); name != "first" {
+		t.Errorf("expected the first certificate, got %q", name)
+	}
+	if cfg.tls.Certificates != nil {
+		t.Error("the shared TLS config was modified")
+	}
+
+	// rotated certificates are used by new connections
+	writeTestCert(t, dir, "second", modTime.Add(time.Second))
+	if tlsCfg, err = cfg.tlsConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(tlsCfg); name != "second" {
+		t.Errorf("expected the rotated certificate, got %q", name)
+	}
+}
+
+func TestSSLMode(t *testing.T) {
+	tests := []struct {
+		mode       string
+		tls        bool
+		skipVerify bool
+	}{
+		{"DISABLED", false, false},
+		{"preferred", true, true},
+		{"REQUIRED", true, true},
+		{"VERIFY_CA", true, false},
+		{"VERIFY_IDENTITY", true, false},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseDSN("tcp(example.com)/?ssl-mode=" + tt.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (cfg.tls != nil) != tt.tls {
+			t.Errorf("%s: expected TLS %t", tt.mode, tt.tls)
+			continue
+		}
+		if tt.tls && cfg.tls.InsecureSkipVerify != tt.skipVerify {
+			t.Errorf("%s: expected InsecureSkipVerify %t", tt.mode, tt.skipVerify)
+		}
+	}
+
+	// VERIFY_CA checks the chain, but not the host name
+	cfg, err := ParseDSN("tcp(example.com)/?ssl-mode=VERIFY_CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tlsCfg.InsecureSkipVerify || tlsCfg.VerifyPeerCertificate == nil {
+		t.Error("VERIFY_CA does not verify the chain by itself")
+	}
+}
+
+func TestVerifyCertChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysql-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestCert(t, dir, "not.the.host", time.Now())
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	if err := verifyCertChain(roots)(cert.Certificate, nil); err != nil {
+		t.Errorf("expected the chain to be valid regardless of the name: %v", err)
+	}
+	if err := verifyCertChain(x509.NewCertPool())(cert.Certificate, nil); err == nil {
+		t.Error("expected an error for an unknown CA")
+	}
+}
+
+func TestSSLModePreferredFallback(t *testing.T) {
+	// testHandshake does not advertise CLIENT_SSL
+	RegisterDialContext("sslmode", func(ctx context.Context, addr string) (net.Conn, error) {
+		return newHandshakeMockConn(), nil
+	})
+
+	cfg, err := ParseDSN("sslmode(db)/?ssl-mode=PREFERRED")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &connector{cfg: cfg}
+	for i := 0; i < 2; i++ {
+		conn, err := c.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mc := conn.(*mysqlConn); mc.cfg.tls != nil {
+			t.Error("the connection should not use TLS")
+		}
+		conn.Close()
+	}
+	if cfg.tls == nil {
+		t.Error("the fallback disabled TLS for all connections")
+	}
+
+	cfg.SSLMode = "REQUIRED"
+	if _, err := c.Connect(context.Background()); err != ErrNoTLS {
+		t.Errorf("expected ErrNoTLS, got %v", err)
+	}
+}